@@ -0,0 +1,19 @@
+package oidcagent
+
+import "github.com/gin-gonic/gin"
+
+// auditLog emits a structured audit event for a security-relevant
+// operation (login, refresh, logout, failed state/nonce checks, ...),
+// tagged with the resolved client IP and local session ID so these events
+// can be correlated with a specific user and request even behind a proxy.
+func (o *OidcAgent) auditLog(c *gin.Context, event, outcome string, extra ...interface{}) {
+	sid, _ := o.sid(c)
+	fields := []interface{}{
+		"audit_event", event,
+		"outcome", outcome,
+		"client_ip", o.ClientIP(c).String(),
+		"session_id", sid,
+	}
+	fields = append(fields, extra...)
+	o.logger.With(fields...).Info("audit")
+}
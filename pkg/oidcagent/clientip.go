@@ -0,0 +1,96 @@
+package oidcagent
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientRemoteIPConfig configures how the agent resolves the real client IP
+// when it's deployed behind a reverse proxy or load balancer that sets a
+// forwarding header.
+type ClientRemoteIPConfig struct {
+	// Header is the forwarding header to trust, e.g. X-Forwarded-For or
+	// X-Real-IP. Left empty, ClientIP always returns the direct peer
+	// address.
+	Header string
+	// TrustedProxies lists the CIDRs allowed to set Header. A hop in the
+	// header is only honored if the peer that handed it to us - walking
+	// right to left - is itself inside one of these prefixes.
+	TrustedProxies []string
+}
+
+// trustedProxies is the parsed form of ClientRemoteIPConfig.TrustedProxies.
+type trustedProxies struct {
+	prefixes []netip.Prefix
+}
+
+func newTrustedProxies(cidrs []string) (*trustedProxies, error) {
+	tp := &trustedProxies{}
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy cidr %q: %w", cidr, err)
+		}
+		tp.prefixes = append(tp.prefixes, prefix)
+	}
+	return tp, nil
+}
+
+func (tp *trustedProxies) contains(addr netip.Addr) bool {
+	for _, prefix := range tp.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteAddrToAddr(remoteAddr string) netip.Addr {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr
+}
+
+// ClientIP resolves the real client address for c. It only trusts
+// o.clientIPHeader when the direct peer is itself a trusted proxy, and
+// walks the header right to left, stopping at the first hop that isn't
+// also a trusted proxy - that hop is the real client. Falls back to the
+// direct peer address otherwise.
+func (o *OidcAgent) ClientIP(c *gin.Context) netip.Addr {
+	remote := remoteAddrToAddr(c.Request.RemoteAddr)
+
+	if o.clientIPHeader == "" || o.trustedProxies == nil || !o.trustedProxies.contains(remote) {
+		return remote
+	}
+
+	header := c.Request.Header.Get(o.clientIPHeader)
+	if header == "" {
+		return remote
+	}
+
+	hops := strings.Split(header, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return remote
+		}
+		if !o.trustedProxies.contains(addr) {
+			return addr
+		}
+		if i == 0 {
+			// every hop, including the oldest one, was a trusted proxy
+			return addr
+		}
+	}
+	return remote
+}
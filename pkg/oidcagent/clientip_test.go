@@ -0,0 +1,92 @@
+package oidcagent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestGinContext(remoteAddr, forwardedFor string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	c.Request = req
+	return c
+}
+
+func newTestAgentForClientIP(t *testing.T, header string, trusted []string) *OidcAgent {
+	t.Helper()
+	tp, err := newTrustedProxies(trusted)
+	if err != nil {
+		t.Fatalf("newTrustedProxies: %v", err)
+	}
+	return &OidcAgent{clientIPHeader: header, trustedProxies: tp}
+}
+
+func TestClientIPNoHeaderConfiguredReturnsDirectPeer(t *testing.T) {
+	o := newTestAgentForClientIP(t, "", nil)
+	c := newTestGinContext("203.0.113.5:1234", "198.51.100.1")
+
+	got := o.ClientIP(c)
+	if got.String() != "203.0.113.5" {
+		t.Errorf("ClientIP = %s, want 203.0.113.5", got)
+	}
+}
+
+func TestClientIPUntrustedPeerIgnoresHeader(t *testing.T) {
+	o := newTestAgentForClientIP(t, "X-Forwarded-For", []string{"10.0.0.0/8"})
+	c := newTestGinContext("203.0.113.5:1234", "198.51.100.1")
+
+	got := o.ClientIP(c)
+	if got.String() != "203.0.113.5" {
+		t.Errorf("ClientIP = %s, want the direct peer since it isn't a trusted proxy", got)
+	}
+}
+
+func TestClientIPTrustedPeerHonorsHeader(t *testing.T) {
+	o := newTestAgentForClientIP(t, "X-Forwarded-For", []string{"10.0.0.0/8"})
+	c := newTestGinContext("10.0.0.1:1234", "198.51.100.1")
+
+	got := o.ClientIP(c)
+	if got.String() != "198.51.100.1" {
+		t.Errorf("ClientIP = %s, want 198.51.100.1", got)
+	}
+}
+
+func TestClientIPStopsAtFirstUntrustedHop(t *testing.T) {
+	o := newTestAgentForClientIP(t, "X-Forwarded-For", []string{"10.0.0.0/8"})
+	// Right-to-left: 10.0.0.2 (trusted) appended the header, the real
+	// client 198.51.100.1 is the hop before it and isn't trusted.
+	c := newTestGinContext("10.0.0.2:1234", "198.51.100.1, 10.0.0.2")
+
+	got := o.ClientIP(c)
+	if got.String() != "198.51.100.1" {
+		t.Errorf("ClientIP = %s, want 198.51.100.1", got)
+	}
+}
+
+func TestClientIPAllHopsTrustedReturnsOldest(t *testing.T) {
+	o := newTestAgentForClientIP(t, "X-Forwarded-For", []string{"10.0.0.0/8"})
+	c := newTestGinContext("10.0.0.3:1234", "10.0.0.1, 10.0.0.2")
+
+	got := o.ClientIP(c)
+	if got.String() != "10.0.0.1" {
+		t.Errorf("ClientIP = %s, want the oldest hop 10.0.0.1", got)
+	}
+}
+
+func TestClientIPMalformedHopFallsBackToPeer(t *testing.T) {
+	o := newTestAgentForClientIP(t, "X-Forwarded-For", []string{"10.0.0.0/8"})
+	c := newTestGinContext("10.0.0.1:1234", "not-an-ip")
+
+	got := o.ClientIP(c)
+	if got.String() != "10.0.0.1" {
+		t.Errorf("ClientIP = %s, want the direct peer on a malformed header", got)
+	}
+}
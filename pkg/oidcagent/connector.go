@@ -0,0 +1,116 @@
+package oidcagent
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Identity is the normalized result of a successful login, regardless of
+// which Connector produced it. The agent mints its own session from this,
+// so UserInfo/Claims/Refresh/Logout/CodeFlowProxy never need to know which
+// connector a session came from.
+type Identity struct {
+	ConnectorID       string
+	Subject           string
+	Email             string
+	PreferredUsername string
+	Groups            []string
+
+	// AccessToken, TokenType, RefreshToken, TokenExpiry and RawIDToken are
+	// only populated by connectors backed by a real upstream oauth2 token
+	// (today, just "oidc"). They're what let UserInfo/Refresh/CodeFlowProxy
+	// keep talking to the upstream provider for that connector.
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	TokenExpiry  time.Time
+	RawIDToken   string
+}
+
+// Connector authenticates a user against one upstream identity source,
+// following dex's connector model. ID must be stable, since it's embedded
+// in the signed login request token and in stored sessions.
+type Connector interface {
+	ID() string
+	// LoginURL builds the URL the frontend should send the browser to in
+	// order to start a login against this connector. state is an opaque,
+	// HMAC-signed token that must be round-tripped back to the agent
+	// unmodified - connectors that don't support an arbitrary state/relay
+	// parameter natively (e.g. a local login form) can track it
+	// themselves and recover it in HandleCallback instead.
+	LoginURL(state, callbackURL string) (string, error)
+	// HandleCallback validates the upstream response carried by r and
+	// returns the resulting Identity.
+	HandleCallback(r *http.Request) (Identity, error)
+}
+
+// Refresher is implemented by connectors that can silently renew a
+// session without involving the browser.
+type Refresher interface {
+	Refresh(ctx context.Context, identity Identity) (Identity, error)
+}
+
+// Revoker is implemented by connectors that can revoke credentials at the
+// upstream source on logout.
+type Revoker interface {
+	Revoke(ctx context.Context, identity Identity) error
+}
+
+// loginReq is the payload of the signed "req" token a connector's LoginURL
+// carries as state, so /web/login/callback (and LoginEnd, for connectors
+// that redirect through the frontend) knows which connector to dispatch
+// the callback to. dex calls this the same thing, for the same reason:
+// "state" is already an overloaded OAuth2/SAML term.
+type loginReq struct {
+	Connector string `json:"connector"`
+	State     string `json:"state"`
+}
+
+// signLoginReq binds a connector ID and a caller-supplied nonce into an
+// HMAC-signed token, so a forged "connector" query parameter can't be used
+// to dispatch a callback to the wrong implementation.
+func (o *OidcAgent) signLoginReq(connectorID, state string) (string, error) {
+	payload, err := json.Marshal(loginReq{Connector: connectorID, State: state})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	mac := hmac.New(sha256.New, o.loginReqHMACKey)
+	mac.Write([]byte(encoded))
+	sig := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	return encoded + "." + sig, nil
+}
+
+// verifyLoginReq checks a token minted by signLoginReq and returns the
+// connector ID and nonce it carries.
+func (o *OidcAgent) verifyLoginReq(req string) (loginReq, bool) {
+	parts := splitSignedToken(req)
+	if len(parts) != 2 {
+		return loginReq{}, false
+	}
+	encoded, sig := parts[0], parts[1]
+
+	mac := hmac.New(sha256.New, o.loginReqHMACKey)
+	mac.Write([]byte(encoded))
+	expected := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		return loginReq{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return loginReq{}, false
+	}
+	var lr loginReq
+	if err := json.Unmarshal(payload, &lr); err != nil {
+		return loginReq{}, false
+	}
+	return lr, true
+}
@@ -0,0 +1,109 @@
+package oidcagent
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPConfig configures a bind+search LDAP connector, dex's "ldap"
+// connector trimmed down to what this agent needs.
+type LDAPConfig struct {
+	Host          string
+	Port          int
+	InsecureNoSSL bool
+
+	// BindDN/BindPW are a service account used to search for the user's
+	// entry before the real bind-as-user check.
+	BindDN string
+	BindPW string
+
+	BaseDN           string
+	UserSearchFilter string // e.g. "(uid=%s)"
+	UsernameAttr     string
+	EmailAttr        string
+}
+
+// LDAPConnector authenticates by binding as a service account, searching
+// for the user's entry, then re-binding as that entry with the supplied
+// password.
+type LDAPConnector struct {
+	cfg LDAPConfig
+}
+
+func NewLDAPConnector(cfg LDAPConfig) *LDAPConnector {
+	return &LDAPConnector{cfg: cfg}
+}
+
+func (l *LDAPConnector) ID() string { return "ldap" }
+
+func (l *LDAPConnector) LoginURL(state, callbackURL string) (string, error) {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("state", state)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (l *LDAPConnector) dial() (*ldap.Conn, error) {
+	addr := fmt.Sprintf("%s:%d", l.cfg.Host, l.cfg.Port)
+	if l.cfg.InsecureNoSSL {
+		return ldap.Dial("tcp", addr)
+	}
+	return ldap.DialTLS("tcp", addr, nil)
+}
+
+func (l *LDAPConnector) HandleCallback(r *http.Request) (Identity, error) {
+	if err := r.ParseForm(); err != nil {
+		return Identity{}, err
+	}
+
+	username := r.PostFormValue("username")
+	password := r.PostFormValue("password")
+	if username == "" || password == "" {
+		return Identity{}, errors.New("ldap connector: username and password are required")
+	}
+
+	conn, err := l.dial()
+	if err != nil {
+		return Identity{}, fmt.Errorf("ldap connector: dial: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(l.cfg.BindDN, l.cfg.BindPW); err != nil {
+		return Identity{}, fmt.Errorf("ldap connector: service account bind: %w", err)
+	}
+
+	searchRequest := ldap.NewSearchRequest(
+		l.cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 1, 0, false,
+		fmt.Sprintf(l.cfg.UserSearchFilter, ldap.EscapeFilter(username)),
+		[]string{l.cfg.UsernameAttr, l.cfg.EmailAttr},
+		nil,
+	)
+	result, err := conn.Search(searchRequest)
+	if err != nil {
+		return Identity{}, fmt.Errorf("ldap connector: user search: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		return Identity{}, errors.New("ldap connector: user not found or ambiguous")
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		return Identity{}, errors.New("ldap connector: invalid credentials")
+	}
+
+	return Identity{
+		ConnectorID:       "ldap",
+		Subject:           entry.DN,
+		PreferredUsername: entry.GetAttributeValue(l.cfg.UsernameAttr),
+		Email:             entry.GetAttributeValue(l.cfg.EmailAttr),
+	}, nil
+}
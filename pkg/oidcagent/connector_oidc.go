@@ -0,0 +1,163 @@
+package oidcagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// pendingLoginTTL bounds how long an abandoned login attempt's nonce/
+// code_verifier is kept around before it expires, so a client that starts
+// but never finishes a login flow can't grow the PendingStore without
+// bound.
+const pendingLoginTTL = 10 * time.Minute
+
+// oidcPendingLoginKeyPrefix namespaces this connector's PendingStore keys
+// from SAML2Connector's, since both share the same store.
+const oidcPendingLoginKeyPrefix = "oidc-login:"
+
+// oidcConnector is the built-in Connector wrapping the authorization code
+// flow this package has always supported. It's what NewOidcAgent registers
+// under the "oidc" ID, so existing deployments that never set a
+// "connector" query parameter keep working unchanged.
+type oidcConnector struct {
+	oauthConfig *oauth2.Config
+	verifier    *oidc.IDTokenVerifier
+	requirePKCE bool
+
+	// pendingStore tracks the nonce/code_verifier/callback URL minted for
+	// a state, since LoginURL only returns a URL - there's no response to
+	// stash them in a cookie with. It's shared across replicas (unless
+	// configured otherwise), so a login started on one instance can be
+	// completed on another, behind a load balancer.
+	pendingStore PendingStore
+}
+
+// oidcPendingLogin is the value tracked in pendingStore between LoginURL
+// and HandleCallback. CallbackURL is the exact RedirectURL LoginURL put in
+// the authorization request - HandleCallback's token exchange must send
+// the identical redirect_uri back, or an IdP enforcing RFC 6749 §4.1.3
+// rejects it with invalid_grant.
+type oidcPendingLogin struct {
+	Nonce       string
+	Verifier    string
+	CallbackURL string
+}
+
+func newOIDCConnector(oauthConfig *oauth2.Config, verifier *oidc.IDTokenVerifier, requirePKCE bool, pendingStore PendingStore) *oidcConnector {
+	return &oidcConnector{
+		oauthConfig:  oauthConfig,
+		verifier:     verifier,
+		requirePKCE:  requirePKCE,
+		pendingStore: pendingStore,
+	}
+}
+
+func (c *oidcConnector) ID() string { return "oidc" }
+
+func (c *oidcConnector) LoginURL(state, callbackURL string) (string, error) {
+	nonce, err := randString(16)
+	if err != nil {
+		return "", err
+	}
+
+	// PKCE (RFC 7636): bind the authorization code to this browser so a
+	// stolen/intercepted code can't be redeemed by anyone else.
+	verifier := oauth2.GenerateVerifier()
+
+	pending, err := json.Marshal(oidcPendingLogin{Nonce: nonce, Verifier: verifier, CallbackURL: callbackURL})
+	if err != nil {
+		return "", err
+	}
+	if err := c.pendingStore.Save(context.Background(), oidcPendingLoginKeyPrefix+state, pending, pendingLoginTTL); err != nil {
+		return "", fmt.Errorf("oidc connector: unable to save pending login: %w", err)
+	}
+
+	cfg := *c.oauthConfig
+	cfg.RedirectURL = callbackURL
+	return cfg.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+func (c *oidcConnector) HandleCallback(r *http.Request) (Identity, error) {
+	values := r.URL.Query()
+	if queryErr := values.Get("error"); queryErr != "" {
+		return Identity{}, fmt.Errorf("oidc connector: %s", queryErr)
+	}
+
+	state := values.Get("state")
+	code := values.Get("code")
+	if state == "" || code == "" {
+		return Identity{}, fmt.Errorf("oidc connector: missing state or code")
+	}
+
+	raw, ok, err := c.pendingStore.Take(r.Context(), oidcPendingLoginKeyPrefix+state)
+	if err != nil {
+		return Identity{}, fmt.Errorf("oidc connector: unable to read pending login: %w", err)
+	}
+	if !ok {
+		return Identity{}, fmt.Errorf("oidc connector: unknown or expired state")
+	}
+	var pending oidcPendingLogin
+	if err := json.Unmarshal(raw, &pending); err != nil {
+		return Identity{}, fmt.Errorf("oidc connector: unable to decode pending login: %w", err)
+	}
+
+	var exchangeOpts []oauth2.AuthCodeOption
+	if pending.Verifier != "" {
+		exchangeOpts = append(exchangeOpts, oauth2.VerifierOption(pending.Verifier))
+	} else if c.requirePKCE {
+		return Identity{}, fmt.Errorf("oidc connector: PKCE is required but no code_verifier was tracked for this state")
+	}
+
+	// Exchange against the same redirect_uri LoginURL sent on the
+	// authorization request - it doesn't have to equal o.oauthConfig's own
+	// RedirectURL, since LoginStart always calls LoginURL with
+	// o.loginCallbackURL.
+	cfg := *c.oauthConfig
+	cfg.RedirectURL = pending.CallbackURL
+
+	oauth2Token, err := cfg.Exchange(r.Context(), code, exchangeOpts...)
+	if err != nil {
+		return Identity{}, fmt.Errorf("oidc connector: unable to exchange token: %w", err)
+	}
+
+	rawIDToken, ok := oauth2Token.Extra("id_token").(string)
+	if !ok {
+		return Identity{}, fmt.Errorf("oidc connector: no id_token field in oauth2 token")
+	}
+
+	idToken, err := c.verifier.Verify(r.Context(), rawIDToken)
+	if err != nil {
+		return Identity{}, fmt.Errorf("oidc connector: unable to verify id_token: %w", err)
+	}
+
+	if idToken.Nonce != pending.Nonce {
+		return Identity{}, fmt.Errorf("oidc connector: nonce did not match")
+	}
+
+	var claims struct {
+		Subject  string `json:"sub"`
+		Email    string `json:"email"`
+		Username string `json:"preferred_username"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return Identity{}, fmt.Errorf("oidc connector: unable to parse id_token claims: %w", err)
+	}
+
+	return Identity{
+		ConnectorID:       "oidc",
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		PreferredUsername: claims.Username,
+		AccessToken:       oauth2Token.AccessToken,
+		TokenType:         oauth2Token.TokenType,
+		RefreshToken:      oauth2Token.RefreshToken,
+		TokenExpiry:       oauth2Token.Expiry,
+		RawIDToken:        rawIDToken,
+	}, nil
+}
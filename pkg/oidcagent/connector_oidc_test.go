@@ -0,0 +1,135 @@
+package oidcagent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func newTestOIDCConnector() *oidcConnector {
+	return newOIDCConnector(&oauth2.Config{
+		ClientID: "test-client",
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  "https://idp.example.com/authorize",
+			TokenURL: "https://idp.example.com/token",
+		},
+	}, nil, false, NewMemoryPendingStore())
+}
+
+func pendingOIDCLogin(t *testing.T, c *oidcConnector, state string) (oidcPendingLogin, bool) {
+	t.Helper()
+	raw, ok, err := c.pendingStore.Take(context.Background(), oidcPendingLoginKeyPrefix+state)
+	if err != nil {
+		t.Fatalf("pendingStore.Take: %v", err)
+	}
+	if !ok {
+		return oidcPendingLogin{}, false
+	}
+	var pending oidcPendingLogin
+	if err := json.Unmarshal(raw, &pending); err != nil {
+		t.Fatalf("unmarshal pending login: %v", err)
+	}
+	return pending, true
+}
+
+func savePendingOIDCLogin(t *testing.T, c *oidcConnector, state string, pending oidcPendingLogin, ttl time.Duration) {
+	t.Helper()
+	raw, err := json.Marshal(pending)
+	if err != nil {
+		t.Fatalf("marshal pending login: %v", err)
+	}
+	if err := c.pendingStore.Save(context.Background(), oidcPendingLoginKeyPrefix+state, raw, ttl); err != nil {
+		t.Fatalf("pendingStore.Save: %v", err)
+	}
+}
+
+func TestOIDCConnectorLoginURLSetsPKCEChallenge(t *testing.T) {
+	c := newTestOIDCConnector()
+
+	raw, err := c.LoginURL("state-1", "https://rp.example.com/callback")
+	if err != nil {
+		t.Fatalf("LoginURL: %v", err)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parsing login URL: %v", err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge") == "" {
+		t.Error("expected a code_challenge parameter, got none")
+	}
+	if got := q.Get("code_challenge_method"); got != "S256" {
+		t.Errorf("code_challenge_method = %q, want S256", got)
+	}
+
+	pending, ok := pendingOIDCLogin(t, c, "state-1")
+	if !ok {
+		t.Fatal("LoginURL did not track pending state")
+	}
+	if pending.Verifier == "" {
+		t.Error("expected a non-empty code_verifier to be tracked for the state")
+	}
+	if pending.CallbackURL != "https://rp.example.com/callback" {
+		t.Errorf("pending.CallbackURL = %q, want the callback URL passed to LoginURL", pending.CallbackURL)
+	}
+}
+
+func TestOIDCConnectorLoginURLUniquePerCall(t *testing.T) {
+	c := newTestOIDCConnector()
+
+	first, err := c.LoginURL("state-a", "https://rp.example.com/callback")
+	if err != nil {
+		t.Fatalf("LoginURL: %v", err)
+	}
+	second, err := c.LoginURL("state-b", "https://rp.example.com/callback")
+	if err != nil {
+		t.Fatalf("LoginURL: %v", err)
+	}
+	if first == second {
+		t.Error("expected distinct URLs for distinct states")
+	}
+
+	pendingA, _ := pendingOIDCLogin(t, c, "state-a")
+	pendingB, _ := pendingOIDCLogin(t, c, "state-b")
+	if pendingA.Verifier == pendingB.Verifier {
+		t.Error("expected distinct code_verifiers per login attempt")
+	}
+}
+
+func TestOIDCConnectorHandleCallbackUnknownState(t *testing.T) {
+	c := newTestOIDCConnector()
+
+	req := httptest.NewRequest(http.MethodGet, "/web/login/callback?state=never-started&code=abc", nil)
+	if _, err := c.HandleCallback(req); err == nil {
+		t.Fatal("expected an error for a state that was never issued")
+	}
+}
+
+func TestOIDCConnectorHandleCallbackExpiredState(t *testing.T) {
+	c := newTestOIDCConnector()
+	savePendingOIDCLogin(t, c, "expired", oidcPendingLogin{Nonce: "n", Verifier: "v", CallbackURL: "https://rp.example.com/callback"}, -time.Second)
+
+	req := httptest.NewRequest(http.MethodGet, "/web/login/callback?state=expired&code=abc", nil)
+	if _, err := c.HandleCallback(req); err == nil {
+		t.Fatal("expected an error for an expired state")
+	}
+
+	if _, stillPending := pendingOIDCLogin(t, c, "expired"); stillPending {
+		t.Error("HandleCallback should consume the pending entry even when it's expired")
+	}
+}
+
+func TestOIDCConnectorHandleCallbackMissingCode(t *testing.T) {
+	c := newTestOIDCConnector()
+	req := httptest.NewRequest(http.MethodGet, "/web/login/callback?state=s", nil)
+	if _, err := c.HandleCallback(req); err == nil {
+		t.Fatal("expected an error when code is missing")
+	}
+}
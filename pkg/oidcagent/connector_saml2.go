@@ -0,0 +1,197 @@
+package oidcagent
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// saml2PendingLoginKeyPrefix namespaces this connector's PendingStore keys
+// from oidcConnector's, since both share the same store.
+const saml2PendingLoginKeyPrefix = "saml2-login:"
+
+// SAML2Config configures a POST-binding SAML 2.0 connector.
+type SAML2Config struct {
+	IDPSSOURL    string
+	EntityID     string
+	UsernameAttr string
+	EmailAttr    string
+
+	// AllowUnverifiedAssertions must be set to acknowledge that this
+	// connector does not verify the assertion's ds:Signature. Without
+	// real XML-DSig verification, anyone who can POST to the login
+	// callback can forge a SAMLResponse and authenticate as an arbitrary
+	// user, so NewSAML2Connector refuses to start unless this is true -
+	// only set it when the IdP is reachable exclusively over a path this
+	// agent already trusts (e.g. a private network with no untrusted hop
+	// able to inject a response).
+	AllowUnverifiedAssertions bool
+}
+
+// SAML2Connector authenticates via the SAML 2.0 Web Browser SSO profile,
+// HTTP-Redirect for the request and HTTP-POST for the response.
+type SAML2Connector struct {
+	cfg SAML2Config
+
+	// pendingStore tracks the AuthnRequest ID issued for each state, so
+	// HandleCallback can confirm InResponseTo corresponds to a request
+	// this connector actually sent, the same way oidcConnector tracks a
+	// nonce/verifier per state. It's shared across replicas (unless
+	// configured otherwise), so a login started on one instance can be
+	// completed on another, behind a load balancer.
+	pendingStore PendingStore
+}
+
+type samlPendingLogin struct {
+	RequestID string
+}
+
+// NewSAML2Connector returns a SAML2Connector, or an error if cfg doesn't
+// explicitly acknowledge that assertion signatures aren't verified yet.
+// pendingStore should be the same PendingStore passed as Options.PendingStore
+// to NewOidcAgent, so a login started on one replica can be completed on
+// another.
+func NewSAML2Connector(cfg SAML2Config, pendingStore PendingStore) (*SAML2Connector, error) {
+	if !cfg.AllowUnverifiedAssertions {
+		return nil, fmt.Errorf("saml2 connector: does not verify assertion signatures yet; set AllowUnverifiedAssertions to opt in, and only do so for an IdP reachable exclusively over a path this agent already trusts")
+	}
+	return &SAML2Connector{cfg: cfg, pendingStore: pendingStore}, nil
+}
+
+func (s *SAML2Connector) ID() string { return "saml2" }
+
+func (s *SAML2Connector) LoginURL(state, callbackURL string) (string, error) {
+	id := "_" + state
+	authnRequest := fmt.Sprintf(
+		`<samlp:AuthnRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="%s" Version="2.0" IssueInstant="%s" Destination="%s" AssertionConsumerServiceURL="%s" ProtocolBinding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"><saml:Issuer xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">%s</saml:Issuer></samlp:AuthnRequest>`,
+		id, time.Now().UTC().Format(time.RFC3339), s.cfg.IDPSSOURL, callbackURL, s.cfg.EntityID,
+	)
+
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write([]byte(authnRequest)); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	pending, err := json.Marshal(samlPendingLogin{RequestID: id})
+	if err != nil {
+		return "", err
+	}
+	if err := s.pendingStore.Save(context.Background(), saml2PendingLoginKeyPrefix+state, pending, pendingLoginTTL); err != nil {
+		return "", fmt.Errorf("saml2 connector: unable to save pending login: %w", err)
+	}
+
+	u, err := url.Parse(s.cfg.IDPSSOURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	q.Set("RelayState", state)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// samlResponse is the subset of a SAML response/assertion this connector
+// reads. It still doesn't verify ds:Signature - see
+// SAML2Config.AllowUnverifiedAssertions - but does check the
+// protocol-level replay/audience/validity guards that don't require it.
+type samlResponse struct {
+	XMLName      xml.Name `xml:"Response"`
+	InResponseTo string   `xml:"InResponseTo,attr"`
+	Assertion    struct {
+		Conditions struct {
+			NotBefore           string `xml:"NotBefore,attr"`
+			NotOnOrAfter        string `xml:"NotOnOrAfter,attr"`
+			AudienceRestriction struct {
+				Audience string `xml:"Audience"`
+			} `xml:"AudienceRestriction"`
+		} `xml:"Conditions"`
+		Subject struct {
+			NameID string `xml:"NameID"`
+		} `xml:"Subject"`
+		AttributeStatement struct {
+			Attributes []struct {
+				Name  string `xml:"Name,attr"`
+				Value string `xml:"AttributeValue"`
+			} `xml:"Attribute"`
+		} `xml:"AttributeStatement"`
+	} `xml:"Assertion"`
+}
+
+func (s *SAML2Connector) HandleCallback(r *http.Request) (Identity, error) {
+	if err := r.ParseForm(); err != nil {
+		return Identity{}, err
+	}
+
+	relayState := r.PostFormValue("RelayState")
+	raw := r.PostFormValue("SAMLResponse")
+	if raw == "" {
+		return Identity{}, errors.New("saml2 connector: missing SAMLResponse")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return Identity{}, fmt.Errorf("saml2 connector: %w", err)
+	}
+
+	var resp samlResponse
+	if err := xml.Unmarshal(decoded, &resp); err != nil {
+		return Identity{}, fmt.Errorf("saml2 connector: %w", err)
+	}
+
+	pendingRaw, ok, err := s.pendingStore.Take(r.Context(), saml2PendingLoginKeyPrefix+relayState)
+	if err != nil {
+		return Identity{}, fmt.Errorf("saml2 connector: unable to read pending login: %w", err)
+	}
+	var want samlPendingLogin
+	if ok {
+		if err := json.Unmarshal(pendingRaw, &want); err != nil {
+			return Identity{}, fmt.Errorf("saml2 connector: unable to decode pending login: %w", err)
+		}
+	}
+	if !ok || resp.InResponseTo != want.RequestID {
+		return Identity{}, errors.New("saml2 connector: InResponseTo did not match a pending request")
+	}
+
+	if resp.Assertion.Conditions.AudienceRestriction.Audience != s.cfg.EntityID {
+		return Identity{}, errors.New("saml2 connector: assertion audience did not match this service provider")
+	}
+
+	now := time.Now().UTC()
+	if notBefore, err := time.Parse(time.RFC3339, resp.Assertion.Conditions.NotBefore); err == nil && now.Before(notBefore) {
+		return Identity{}, errors.New("saml2 connector: assertion is not yet valid")
+	}
+	if notOnOrAfter, err := time.Parse(time.RFC3339, resp.Assertion.Conditions.NotOnOrAfter); err == nil && !now.Before(notOnOrAfter) {
+		return Identity{}, errors.New("saml2 connector: assertion has expired")
+	}
+
+	if resp.Assertion.Subject.NameID == "" {
+		return Identity{}, errors.New("saml2 connector: assertion has no subject")
+	}
+
+	attrs := make(map[string]string, len(resp.Assertion.AttributeStatement.Attributes))
+	for _, attr := range resp.Assertion.AttributeStatement.Attributes {
+		attrs[attr.Name] = attr.Value
+	}
+
+	return Identity{
+		ConnectorID:       "saml2",
+		Subject:           resp.Assertion.Subject.NameID,
+		Email:             attrs[s.cfg.EmailAttr],
+		PreferredUsername: attrs[s.cfg.UsernameAttr],
+	}, nil
+}
@@ -0,0 +1,147 @@
+package oidcagent
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSAML2ConnectorRequiresOptIn(t *testing.T) {
+	if _, err := NewSAML2Connector(SAML2Config{EntityID: "sp"}, NewMemoryPendingStore()); err == nil {
+		t.Fatal("expected an error when AllowUnverifiedAssertions is not set")
+	}
+}
+
+func newTestSAML2Connector(t *testing.T) *SAML2Connector {
+	t.Helper()
+	conn, err := NewSAML2Connector(SAML2Config{
+		IDPSSOURL:                 "https://idp.example.com/sso",
+		EntityID:                  "https://sp.example.com",
+		UsernameAttr:              "username",
+		EmailAttr:                 "email",
+		AllowUnverifiedAssertions: true,
+	}, NewMemoryPendingStore())
+	if err != nil {
+		t.Fatalf("NewSAML2Connector: %v", err)
+	}
+	return conn
+}
+
+func pendingSAML2RequestID(t *testing.T, conn *SAML2Connector, state string) string {
+	t.Helper()
+	raw, ok, err := conn.pendingStore.Take(context.Background(), saml2PendingLoginKeyPrefix+state)
+	if err != nil {
+		t.Fatalf("pendingStore.Take: %v", err)
+	}
+	if !ok {
+		t.Fatalf("no pending login tracked for state %q", state)
+	}
+	var pending samlPendingLogin
+	if err := json.Unmarshal(raw, &pending); err != nil {
+		t.Fatalf("unmarshal pending login: %v", err)
+	}
+	// HandleCallback also reads via Take, so put it back for it to consume.
+	if err := conn.pendingStore.Save(context.Background(), saml2PendingLoginKeyPrefix+state, raw, time.Minute); err != nil {
+		t.Fatalf("pendingStore.Save: %v", err)
+	}
+	return pending.RequestID
+}
+
+func postSAMLResponse(t *testing.T, relayState, samlResponseXML string) *http.Request {
+	t.Helper()
+	form := url.Values{
+		"RelayState":   {relayState},
+		"SAMLResponse": {base64.StdEncoding.EncodeToString([]byte(samlResponseXML))},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/web/login/callback", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func samlResponseXML(inResponseTo, audience, notBefore, notOnOrAfter string) string {
+	return `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" InResponseTo="` + inResponseTo + `">
+		<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">
+			<saml:Conditions NotBefore="` + notBefore + `" NotOnOrAfter="` + notOnOrAfter + `">
+				<saml:AudienceRestriction><saml:Audience>` + audience + `</saml:Audience></saml:AudienceRestriction>
+			</saml:Conditions>
+			<saml:Subject><saml:NameID>alice</saml:NameID></saml:Subject>
+		</saml:Assertion>
+	</samlp:Response>`
+}
+
+func TestSAML2ConnectorHandleCallbackSuccess(t *testing.T) {
+	conn := newTestSAML2Connector(t)
+	if _, err := conn.LoginURL("state-1", "https://sp.example.com/callback"); err != nil {
+		t.Fatalf("LoginURL: %v", err)
+	}
+
+	requestID := pendingSAML2RequestID(t, conn, "state-1")
+
+	now := time.Now().UTC()
+	xml := samlResponseXML(requestID, conn.cfg.EntityID,
+		now.Add(-time.Minute).Format(time.RFC3339), now.Add(time.Minute).Format(time.RFC3339))
+
+	identity, err := conn.HandleCallback(postSAMLResponse(t, "state-1", xml))
+	if err != nil {
+		t.Fatalf("HandleCallback: %v", err)
+	}
+	if identity.Subject != "alice" {
+		t.Errorf("identity.Subject = %q, want alice", identity.Subject)
+	}
+}
+
+func TestSAML2ConnectorHandleCallbackRejectsUnknownRelayState(t *testing.T) {
+	conn := newTestSAML2Connector(t)
+	xml := samlResponseXML("_anything", conn.cfg.EntityID, "", "")
+
+	if _, err := conn.HandleCallback(postSAMLResponse(t, "never-issued", xml)); err == nil {
+		t.Fatal("expected an error for a RelayState that was never issued")
+	}
+}
+
+func TestSAML2ConnectorHandleCallbackRejectsMismatchedInResponseTo(t *testing.T) {
+	conn := newTestSAML2Connector(t)
+	if _, err := conn.LoginURL("state-1", "https://sp.example.com/callback"); err != nil {
+		t.Fatalf("LoginURL: %v", err)
+	}
+
+	xml := samlResponseXML("_forged-request-id", conn.cfg.EntityID, "", "")
+	if _, err := conn.HandleCallback(postSAMLResponse(t, "state-1", xml)); err == nil {
+		t.Fatal("expected an error when InResponseTo doesn't match the tracked request ID")
+	}
+}
+
+func TestSAML2ConnectorHandleCallbackRejectsWrongAudience(t *testing.T) {
+	conn := newTestSAML2Connector(t)
+	if _, err := conn.LoginURL("state-1", "https://sp.example.com/callback"); err != nil {
+		t.Fatalf("LoginURL: %v", err)
+	}
+	requestID := pendingSAML2RequestID(t, conn, "state-1")
+
+	xml := samlResponseXML(requestID, "https://some-other-sp.example.com", "", "")
+	if _, err := conn.HandleCallback(postSAMLResponse(t, "state-1", xml)); err == nil {
+		t.Fatal("expected an error for an assertion audience that doesn't match this SP")
+	}
+}
+
+func TestSAML2ConnectorHandleCallbackRejectsExpiredAssertion(t *testing.T) {
+	conn := newTestSAML2Connector(t)
+	if _, err := conn.LoginURL("state-1", "https://sp.example.com/callback"); err != nil {
+		t.Fatalf("LoginURL: %v", err)
+	}
+	requestID := pendingSAML2RequestID(t, conn, "state-1")
+
+	now := time.Now().UTC()
+	xml := samlResponseXML(requestID, conn.cfg.EntityID,
+		now.Add(-time.Hour).Format(time.RFC3339), now.Add(-time.Minute).Format(time.RFC3339))
+
+	if _, err := conn.HandleCallback(postSAMLResponse(t, "state-1", xml)); err == nil {
+		t.Fatal("expected an error for an assertion past its NotOnOrAfter")
+	}
+}
@@ -0,0 +1,79 @@
+package oidcagent
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// StaticUser is one entry in a StaticConnector's password list.
+type StaticUser struct {
+	Username          string
+	BcryptHash        string
+	Email             string
+	PreferredUsername string
+}
+
+// StaticConnector authenticates against a fixed, in-memory list of
+// bcrypt-hashed passwords. It exists for local dev and CI where standing
+// up a real IdP isn't worth it - it must never be wired up for a
+// production deployment.
+type StaticConnector struct {
+	users map[string]StaticUser
+}
+
+// NewStaticConnector builds a StaticConnector from a list of users.
+func NewStaticConnector(users []StaticUser) *StaticConnector {
+	m := make(map[string]StaticUser, len(users))
+	for _, u := range users {
+		m[u.Username] = u
+	}
+	return &StaticConnector{users: m}
+}
+
+func (s *StaticConnector) ID() string { return "static" }
+
+// LoginURL points back at the agent's own callback with the signed state
+// attached - there's no upstream IdP to redirect to, the browser is meant
+// to render a local username/password form that POSTs straight to this
+// URL.
+func (s *StaticConnector) LoginURL(state, callbackURL string) (string, error) {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("state", state)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (s *StaticConnector) HandleCallback(r *http.Request) (Identity, error) {
+	if err := r.ParseForm(); err != nil {
+		return Identity{}, err
+	}
+
+	username := r.PostFormValue("username")
+	password := r.PostFormValue("password")
+	if username == "" || password == "" {
+		return Identity{}, errors.New("static connector: username and password are required")
+	}
+
+	user, ok := s.users[username]
+	if !ok {
+		return Identity{}, errors.New("static connector: invalid credentials")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.BcryptHash), []byte(password)); err != nil {
+		return Identity{}, errors.New("static connector: invalid credentials")
+	}
+
+	return Identity{
+		ConnectorID:       "static",
+		Subject:           fmt.Sprintf("static|%s", username),
+		Email:             user.Email,
+		PreferredUsername: user.PreferredUsername,
+	}, nil
+}
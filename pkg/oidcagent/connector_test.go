@@ -0,0 +1,99 @@
+package oidcagent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSignAndVerifyLoginReqRoundTrip(t *testing.T) {
+	o := &OidcAgent{loginReqHMACKey: []byte("fedcba9876543210fedcba9876543210")}
+
+	token, err := o.signLoginReq("saml2", "state-1")
+	if err != nil {
+		t.Fatalf("signLoginReq: %v", err)
+	}
+
+	lr, ok := o.verifyLoginReq(token)
+	if !ok {
+		t.Fatal("verifyLoginReq rejected a token it signed")
+	}
+	if lr.Connector != "saml2" || lr.State != "state-1" {
+		t.Errorf("verifyLoginReq = %+v, want {saml2 state-1}", lr)
+	}
+}
+
+func TestVerifyLoginReqRejectsForgedConnector(t *testing.T) {
+	o := &OidcAgent{loginReqHMACKey: []byte("fedcba9876543210fedcba9876543210")}
+
+	token, err := o.signLoginReq("oidc", "state-1")
+	if err != nil {
+		t.Fatalf("signLoginReq: %v", err)
+	}
+	parts := strings.SplitN(token, ".", 2)
+	forged, err := (&OidcAgent{loginReqHMACKey: []byte("attacker-controlled-key-attacker")}).signLoginReq("static", "state-1")
+	if err != nil {
+		t.Fatalf("signLoginReq(forged): %v", err)
+	}
+	forgedParts := strings.SplitN(forged, ".", 2)
+
+	// Swap in the attacker's payload but keep the legitimate signature.
+	tampered := forgedParts[0] + "." + parts[1]
+	if _, ok := o.verifyLoginReq(tampered); ok {
+		t.Fatal("verifyLoginReq accepted a payload not covered by its signature")
+	}
+}
+
+func TestStaticConnectorHandleCallback(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt.GenerateFromPassword: %v", err)
+	}
+	conn := NewStaticConnector([]StaticUser{
+		{Username: "alice", BcryptHash: string(hash), Email: "alice@example.com", PreferredUsername: "alice"},
+	})
+
+	form := url.Values{"username": {"alice"}, "password": {"correct-password"}}
+	req := httptest.NewRequest(http.MethodPost, "/web/login/callback", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	identity, err := conn.HandleCallback(req)
+	if err != nil {
+		t.Fatalf("HandleCallback: %v", err)
+	}
+	if identity.Subject != "static|alice" || identity.Email != "alice@example.com" {
+		t.Errorf("identity = %+v", identity)
+	}
+}
+
+func TestStaticConnectorHandleCallbackWrongPassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt.GenerateFromPassword: %v", err)
+	}
+	conn := NewStaticConnector([]StaticUser{{Username: "alice", BcryptHash: string(hash)}})
+
+	form := url.Values{"username": {"alice"}, "password": {"wrong-password"}}
+	req := httptest.NewRequest(http.MethodPost, "/web/login/callback", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if _, err := conn.HandleCallback(req); err == nil {
+		t.Fatal("expected an error for an incorrect password")
+	}
+}
+
+func TestStaticConnectorHandleCallbackUnknownUser(t *testing.T) {
+	conn := NewStaticConnector([]StaticUser{{Username: "alice", BcryptHash: "irrelevant"}})
+
+	form := url.Values{"username": {"mallory"}, "password": {"anything"}}
+	req := httptest.NewRequest(http.MethodPost, "/web/login/callback", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if _, err := conn.HandleCallback(req); err == nil {
+		t.Fatal("expected an error for an unknown username")
+	}
+}
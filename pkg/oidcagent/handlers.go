@@ -8,27 +8,24 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gin-gonic/gin"
-	"github.com/nexodus-io/nexodus/pkg/ginsession"
 	"github.com/nexodus-io/nexodus/pkg/oidcagent/models"
 	"golang.org/x/oauth2"
 )
 
-const (
-	TokenKey   = "token"
-	IDTokenKey = "id_token"
-)
+// sidCookieName is the only thing the browser ever holds for a logged-in
+// user - an opaque session ID. The actual token material lives in
+// o.sessionStore, keyed by this ID.
+const sidCookieName = "sid"
 
 func randString(nByte int) (string, error) {
 	b := make([]byte, nByte)
-	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
 	return base64.RawURLEncoding.EncodeToString(b), nil
@@ -47,47 +44,139 @@ func (o *OidcAgent) prepareContext(c *gin.Context) context.Context {
 	return c.Request.Context()
 }
 
-// LoginStart starts a login request
+func (o *OidcAgent) sid(c *gin.Context) (string, bool) {
+	sid, err := c.Cookie(sidCookieName)
+	if err != nil || sid == "" {
+		return "", false
+	}
+	return sid, true
+}
+
+func (o *OidcAgent) setSIDCookie(c *gin.Context, sid string) {
+	c.SetCookie(sidCookieName, sid, 0, "/", "", c.Request.URL.Scheme == "https", true)
+}
+
+func (o *OidcAgent) clearSIDCookie(c *gin.Context) {
+	c.SetCookie(sidCookieName, "", -1, "/", "", c.Request.URL.Scheme == "https", true)
+}
+
+// LoginStart starts a login request against a connector
 // @Summary      Start Web Login
-// @Description  Starts a login request for the frontend application
+// @Description  Starts a login request for the frontend application against the named connector (default "oidc")
 // @Id 			 WebStart
 // @Tags         Auth
 // @Accepts		 json
 // @Produce      json
+// @Param        connector  query string  false "Connector ID, defaults to oidc"
 // @Success      200  {object}  models.LoginStartResponse "OK"
+// @Failure      404  {string}  json "Not Found, unknown connector"
 // @Failure      500  {string}  json "Internal Server Error"
 // @Router       /web/login/start [post]
 func (o *OidcAgent) LoginStart(c *gin.Context) {
-	logger := o.logger
+	connectorID := c.DefaultQuery("connector", "oidc")
+	connector, ok := o.connectors[connectorID]
+	if !ok {
+		o.logger.With("connector", connectorID).Debug("unknown connector")
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
 	state, err := randString(16)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
-	nonce, err := randString(16)
+	req, err := o.signLoginReq(connectorID, state)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
-	logger = logger.With(
-		"state", state,
-		"nonce", nonce,
-	)
+	loginURL, err := connector.LoginURL(req, o.loginCallbackURL)
+	if err != nil {
+		o.logger.With("error", err, "connector", connectorID).Debug("unable to build connector login url")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
 
-	c.SetSameSite(http.SameSiteStrictMode)
-	c.SetCookie("state", state, int(time.Hour.Seconds()), "/", "", c.Request.URL.Scheme == "https", true)
-	c.SetCookie("nonce", nonce, int(time.Hour.Seconds()), "/", "", c.Request.URL.Scheme == "https", true)
-	logger.Debug("set cookies")
+	o.auditLog(c, "login_start", "success", "connector", connectorID)
 	c.JSON(http.StatusOK, models.LoginStartResponse{
-		AuthorizationRequestURL: o.oauthConfig.AuthCodeURL(state, oidc.Nonce(nonce)),
+		AuthorizationRequestURL: loginURL,
 	})
 }
 
+// completeLogin finishes a login for whichever connector the signed reqToken
+// names, given the *http.Request carrying that connector's callback
+// parameters. It mints the agent's own session from the resulting Identity,
+// so callers never need to branch on connector type again.
+func (o *OidcAgent) completeLogin(c *gin.Context, r *http.Request, reqToken string) (Identity, error) {
+	lr, ok := o.verifyLoginReq(reqToken)
+	if !ok {
+		return Identity{}, fmt.Errorf("invalid or expired login request")
+	}
+
+	connector, ok := o.connectors[lr.Connector]
+	if !ok {
+		return Identity{}, fmt.Errorf("unknown connector %q", lr.Connector)
+	}
+
+	identity, err := connector.HandleCallback(r)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	ctx := o.prepareContext(c)
+
+	sid, err := generateNewSID()
+	if err != nil {
+		return Identity{}, fmt.Errorf("unable to generate session id: %w", err)
+	}
+
+	data := &SessionData{
+		ConnectorID:       identity.ConnectorID,
+		Subject:           identity.Subject,
+		Email:             identity.Email,
+		PreferredUsername: identity.PreferredUsername,
+		Groups:            identity.Groups,
+		IDToken:           identity.RawIDToken,
+	}
+	if identity.AccessToken != "" {
+		tokenString, err := tokenToJSONString(&oauth2.Token{
+			AccessToken:  identity.AccessToken,
+			TokenType:    identity.TokenType,
+			RefreshToken: identity.RefreshToken,
+			Expiry:       identity.TokenExpiry,
+		})
+		if err != nil {
+			return Identity{}, fmt.Errorf("can't convert token to string: %w", err)
+		}
+		data.Token = tokenString
+	}
+
+	if err := o.sessionStore.Save(ctx, sid, data); err != nil {
+		return Identity{}, fmt.Errorf("can't save session storage: %w", err)
+	}
+	o.setSIDCookie(c, sid)
+
+	var idpSID string
+	if identity.ConnectorID == "oidc" && identity.RawIDToken != "" {
+		if idToken, err := o.verifier.Verify(ctx, identity.RawIDToken); err == nil {
+			var claims struct {
+				SID string `json:"sid"`
+			}
+			_ = idToken.Claims(&claims)
+			idpSID = claims.SID
+		}
+	}
+	o.sessions.register(ctx, idpSID, identity.Subject, sid)
+
+	return identity, nil
+}
+
 // LoginEnd completes the login request
 // @Summary      End Web Login
-// @Description  Handles the callback from the OAuth2 provider and completes the login process.
+// @Description  Handles the callback from the connector and completes the login process.
 // @Id 			 WebEnd
 // @Tags         Auth
 // @Accepts		 json
@@ -100,8 +189,7 @@ func (o *OidcAgent) LoginStart(c *gin.Context) {
 // @Router       /web/login/end [post]
 func (o *OidcAgent) LoginEnd(c *gin.Context) {
 	var data models.LoginEndRequest
-	err := c.BindJSON(&data)
-	if err != nil {
+	if err := c.BindJSON(&data); err != nil {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
@@ -113,131 +201,98 @@ func (o *OidcAgent) LoginEnd(c *gin.Context) {
 	}
 
 	logger := o.logger
-	ctx := o.prepareContext(c)
 	logger.Debug("handling login end request")
 
 	values := requestURL.Query()
-	code := values.Get("code")
-	state := values.Get("state")
+	reqToken := values.Get("state")
 	queryErr := values.Get("error")
 
-	failed := state != "" && queryErr != ""
-
+	failed := reqToken != "" && queryErr != ""
 	if failed {
 		logger.Debug("login failed")
-		var status int
+		o.auditLog(c, "login_end", "failure", "idp_error", queryErr)
+		status := http.StatusBadRequest
 		if queryErr == "login_required" {
 			status = http.StatusUnauthorized
-		} else {
-			status = http.StatusBadRequest
 		}
 		c.AbortWithStatus(status)
 		return
 	}
 
-	handleAuth := state != "" && code != ""
+	handleAuth := reqToken != "" && values.Get("code") != ""
 
 	loggedIn := false
 	if handleAuth {
-		logger.Debug("login success")
-		originalState, err := c.Cookie("state")
+		callbackReq := (&http.Request{URL: requestURL}).WithContext(c.Request.Context())
+		identity, err := o.completeLogin(c, callbackReq, reqToken)
 		if err != nil {
-			logger.With(
-				"error", err,
-			).Debug("unable to access state cookie")
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
-
-		c.SetCookie("state", "", -1, "/", "", c.Request.URL.Scheme == "https", true)
-		if state != originalState {
-			logger.With(
-				"error", err,
-			).Debug("state does not match")
+			logger.With("error", err).Debug("login failed")
+			o.auditLog(c, "login_end", "failure", "reason", err.Error())
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
 
-		nonce, err := c.Cookie("nonce")
-		if err != nil {
-			logger.With(
-				"error", err,
-			).Debug("unable to get nonce cookie")
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
-		c.SetCookie("nonce", "", -1, "/", "", c.Request.URL.Scheme == "https", true)
-
-		oauth2Token, err := o.oauthConfig.Exchange(ctx, code)
-		if err != nil {
-			logger.With(
-				"error", err,
-			).Debug("unable to exchange token")
-			_ = c.AbortWithError(http.StatusInternalServerError, err)
-			return
-		}
-
-		rawIDToken, ok := oauth2Token.Extra("id_token").(string)
-		if !ok {
-			logger.With(
-				"ok", ok,
-			).Debug("unable to get id_token")
-			_ = c.AbortWithError(http.StatusInternalServerError, fmt.Errorf("no id_token field in oauth2 token"))
-			return
-		}
-
-		idToken, err := o.verifier.Verify(ctx, rawIDToken)
-		if err != nil {
-			logger.With(
-				"error", err,
-			).Debug("unable to verify id_token")
-			_ = c.AbortWithError(http.StatusInternalServerError, err)
-			return
-		}
-
-		if idToken.Nonce != nonce {
-			logger.Debug("nonce does not match")
-			_ = c.AbortWithError(http.StatusBadRequest, fmt.Errorf("nonce did not match"))
-			return
+		o.auditLog(c, "login_end", "success", "sub", identity.Subject, "connector", identity.ConnectorID)
+		if identity.AccessToken != "" {
+			c.Header("Authorization", fmt.Sprintf("Bearer %s", identity.AccessToken))
 		}
-
-		session := ginsession.FromContext(c)
-		tokenString, err := tokenToJSONString(oauth2Token)
-		if err != nil {
-			logger.Debug("can't convert token to string")
-			_ = c.AbortWithError(http.StatusBadRequest, fmt.Errorf("can't convert token to string"))
-			return
-		}
-		session.Set(TokenKey, tokenString)
-		session.Set(IDTokenKey, rawIDToken)
-		if err := session.Save(); err != nil {
-			logger.With("error", err,
-				"id_token_size", len(rawIDToken)).Debug("can't save session storage")
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
-
-		c.Header("Authorization", fmt.Sprintf("Bearer %s", oauth2Token.AccessToken))
-
-		logger.With("session_id", session.SessionID()).Debug("user is logged in")
 		loggedIn = true
 	} else {
 		logger.Debug("checking if user is logged in")
-		loggedIn = isLoggedIn(c)
+		loggedIn = o.isLoggedIn(c)
 	}
 
-	session := ginsession.FromContext(c)
-	logger.With("session_id", session.SessionID()).With("logged_in", loggedIn).Debug("complete")
-	res := models.LoginEndResponse{
+	sid, _ := o.sid(c)
+	logger.With("session_id", sid).With("logged_in", loggedIn).Debug("complete")
+	c.JSON(http.StatusOK, models.LoginEndResponse{
 		Handled:  handleAuth,
 		LoggedIn: loggedIn,
+	})
+}
+
+// LoginCallback dispatches an IdP login callback directly to the connector
+// named in the signed state/RelayState, for connectors whose response never
+// goes through the frontend (e.g. SAML's POST binding, or a local login
+// form submitted straight to the agent).
+// @Summary      Login Callback
+// @Description  Dispatches an IdP login callback to the connector named in the signed state and completes login
+// @Id 			 WebLoginCallback
+// @Tags         Auth
+// @Success      200  {string}  json "OK"
+// @Failure      302  {string}  json "Found, redirected to PostLoginRedirectURL"
+// @Failure      400  {string}  json "Bad Request, invalid state or connector callback failure"
+// @Router       /web/login/callback [get]
+// @Router       /web/login/callback [post]
+func (o *OidcAgent) LoginCallback(c *gin.Context) {
+	reqToken := c.Query("state")
+	if reqToken == "" {
+		reqToken = c.PostForm("RelayState")
+	}
+	if reqToken == "" {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
 	}
-	c.JSON(http.StatusOK, res)
+
+	identity, err := o.completeLogin(c, c.Request, reqToken)
+	if err != nil {
+		o.logger.With("error", err).Debug("login callback failed")
+		o.auditLog(c, "login_end", "failure", "reason", err.Error())
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	o.auditLog(c, "login_end", "success", "sub", identity.Subject, "connector", identity.ConnectorID)
+
+	if o.postLoginRedirectURL != "" {
+		c.Redirect(http.StatusFound, o.postLoginRedirectURL)
+		return
+	}
+	c.Status(http.StatusOK)
 }
 
 // UserInfo gets information about the current user
 // @Summary      Retrieve User Information
-// @Description  Fetches the information of the currently logged-in user from the OAuth2 provider.
+// @Description  Fetches the information of the currently logged-in user, from the OAuth2 provider for the oidc connector or from the normalized session claims otherwise.
 // @Id 			 UserInfo
 // @Tags         Auth
 // @Accepts		 json
@@ -247,14 +302,30 @@ func (o *OidcAgent) LoginEnd(c *gin.Context) {
 // @Failure      500 {string}  json "Internal Server Error, during token validation or info retrieval"
 // @Router       /web/user_info [get]
 func (o *OidcAgent) UserInfo(c *gin.Context) {
-	session := ginsession.FromContext(c)
 	ctx := o.prepareContext(c)
-	tokenRaw, ok := session.Get(TokenKey)
+	sid, ok := o.sid(c)
 	if !ok {
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
-	token, err := JsonStringToToken(tokenRaw.(string))
+	data, err := o.sessionStore.Get(ctx, sid)
+	if err != nil {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if data.Token == "" {
+		// Non-oidc connectors have no upstream userinfo endpoint - the
+		// normalized claims captured at login are all there is.
+		c.JSON(http.StatusOK, models.UserInfoResponse{
+			Subject:           data.Subject,
+			PreferredUsername: data.PreferredUsername,
+			Email:             data.Email,
+		})
+		return
+	}
+
+	token, err := JsonStringToToken(data.Token)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
@@ -269,6 +340,7 @@ func (o *OidcAgent) UserInfo(c *gin.Context) {
 
 	var claims struct {
 		Username   string `json:"preferred_username"`
+		Email      string `json:"email"`
 		GivenName  string `json:"given_name"`
 		FamilyName string `json:"family_name"`
 		Picture    string `json:"picture"`
@@ -284,8 +356,9 @@ func (o *OidcAgent) UserInfo(c *gin.Context) {
 	res := models.UserInfoResponse{
 		Subject:           info.Subject,
 		PreferredUsername: claims.Username,
+		Email:             claims.Email,
 		GivenName:         claims.GivenName,
-		UpdatedAt:         int64(claims.UpdatedAt),
+		UpdatedAt:         claims.UpdatedAt,
 		FamilyName:        claims.FamilyName,
 		Picture:           claims.Picture,
 	}
@@ -295,7 +368,7 @@ func (o *OidcAgent) UserInfo(c *gin.Context) {
 
 // Claims gets the claims of the users access token
 // @Summary      Claims
-// @Description  Gets the claims of the users access token
+// @Description  Gets the claims of the users access token, or the normalized session claims for connectors without an id_token
 // @Id 			 Claims
 // @Tags         Auth
 // @Accepts		 json
@@ -305,21 +378,36 @@ func (o *OidcAgent) UserInfo(c *gin.Context) {
 // @Failure      500  {string}  json "Internal Server Error"
 // @Router       /web/claims [get]
 func (o *OidcAgent) Claims(c *gin.Context) {
-	session := ginsession.FromContext(c)
 	ctx := o.prepareContext(c)
-	idTokenRaw, ok := session.Get(IDTokenKey)
+	sid, ok := o.sid(c)
 	if !ok {
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
-	idToken, err := o.verifier.Verify(ctx, idTokenRaw.(string))
+	data, err := o.sessionStore.Get(ctx, sid)
+	if err != nil {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if data.IDToken == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"sub":                data.Subject,
+			"email":              data.Email,
+			"preferred_username": data.PreferredUsername,
+			"groups":             data.Groups,
+		})
+		return
+	}
+
+	idToken, err := o.verifier.Verify(ctx, data.IDToken)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
 	var claims map[string]interface{}
-	err = idToken.Claims(claims)
+	err = idToken.Claims(&claims)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
@@ -339,20 +427,49 @@ func (o *OidcAgent) Claims(c *gin.Context) {
 // @Failure      500  {string}  json "Internal Server Error"
 // @Router       /web/refresh [get]
 func (o *OidcAgent) Refresh(c *gin.Context) {
-	session := ginsession.FromContext(c)
-
 	ctx := o.prepareContext(c)
 
-	// Existing token retrieval
-	tokenRaw, ok := session.Get(TokenKey)
+	sid, ok := o.sid(c)
 	if !ok {
-		o.logger.Debug("Token not found in session")
+		o.logger.Debug("No session cookie present")
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 
+	data, err := o.sessionStore.Get(ctx, sid)
+	if err != nil {
+		o.logger.Debug("Session not found in store")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if data.Token == "" {
+		// No upstream oauth2 token to refresh. Connectors that can
+		// silently renew anyway (e.g. one backed by a short-lived
+		// upstream session) implement Refresher; everything else is a
+		// no-op - the local session just keeps its own lifetime.
+		connector, ok := o.connectors[data.ConnectorID]
+		refresher, isRefresher := connector.(Refresher)
+		if !ok || !isRefresher {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		if _, err := refresher.Refresh(ctx, Identity{ConnectorID: data.ConnectorID, Subject: data.Subject}); err != nil {
+			o.logger.With("error", err).Debug("connector refresh failed")
+			o.auditLog(c, "refresh", "failure")
+			o.sessions.unregister(ctx, sid)
+			_ = o.sessionStore.Delete(ctx, sid)
+			o.clearSIDCookie(c)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		o.auditLog(c, "refresh", "success")
+		c.Status(http.StatusNoContent)
+		return
+	}
+
 	// Token decoding
-	token, err := JsonStringToToken(tokenRaw.(string))
+	token, err := JsonStringToToken(data.Token)
 	if err != nil {
 		o.logger.Debug("Failed to decode token")
 		c.AbortWithStatus(http.StatusInternalServerError)
@@ -364,7 +481,12 @@ func (o *OidcAgent) Refresh(c *gin.Context) {
 	newToken, err := src.Token()
 	if err != nil {
 		o.logger.Debug("Failed to refresh token")
-		c.AbortWithStatus(http.StatusInternalServerError)
+		o.auditLog(c, "refresh", "failure")
+		o.revokeSessionTokens(ctx, data.Token)
+		o.sessions.unregister(ctx, sid)
+		_ = o.sessionStore.Delete(ctx, sid)
+		o.clearSIDCookie(c)
+		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 
@@ -384,19 +506,20 @@ func (o *OidcAgent) Refresh(c *gin.Context) {
 		return
 	}
 
-	// Updating session with new token and new session ID
-	session.Set(TokenKey, tokenString)
-	session.Set("sessionID", newSID)
-
-	// Save session
-	if err := session.Save(); err != nil {
+	// Store the refreshed token under the new session ID and retire the old one
+	newData := *data
+	newData.Token = tokenString
+	if err := o.sessionStore.Save(ctx, newSID, &newData); err != nil {
 		o.logger.Debug("Failed to save session")
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
+	_ = o.sessionStore.Delete(ctx, sid)
+	o.sessions.rekey(ctx, sid, newSID)
+	o.auditLog(c, "refresh", "success")
 
 	// Set the session ID as a cookie
-	c.SetCookie("sessionID", newSID, 0, "/", "", c.Request.URL.Scheme == "https", true)
+	o.setSIDCookie(c, newSID)
 	c.Header("Authorization", fmt.Sprintf("Bearer %s", newToken.AccessToken))
 
 	c.Status(http.StatusNoContent)
@@ -414,40 +537,163 @@ func (o *OidcAgent) Refresh(c *gin.Context) {
 // @Failure      500  {string}  json "Internal Server Error"
 // @Router       /web/logout [post]
 func (o *OidcAgent) Logout(c *gin.Context) {
-	session := ginsession.FromContext(c)
-	idToken, ok := session.Get(IDTokenKey)
+	ctx := o.prepareContext(c)
+
+	sid, ok := o.sid(c)
 	if !ok {
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 
-	session.Delete(IDTokenKey)
-	session.Delete(TokenKey)
-	if err := session.Save(); err != nil {
-		c.AbortWithStatus(http.StatusInternalServerError)
+	data, err := o.sessionStore.Get(ctx, sid)
+	if err != nil {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	o.revokeSessionTokens(ctx, data.Token)
+	if connector, ok := o.connectors[data.ConnectorID]; ok {
+		if revoker, ok := connector.(Revoker); ok {
+			if err := revoker.Revoke(ctx, Identity{ConnectorID: data.ConnectorID, Subject: data.Subject}); err != nil {
+				o.logger.With("error", err).Debug("connector revoke failed")
+			}
+		}
+	}
+	_ = o.sessionStore.Delete(ctx, sid)
+	o.sessions.unregister(ctx, sid)
+	o.clearSIDCookie(c)
+	o.auditLog(c, "logout", "success")
+
+	logoutURLStr := ""
+	if data.ConnectorID == "oidc" {
+		logoutURL, err := o.LogoutURL(data.IDToken, sid)
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		logoutURLStr = logoutURL.String()
+	}
+
+	c.JSON(http.StatusOK, models.LogoutResponse{
+		LogoutURL: logoutURLStr,
+	})
+}
+
+// LogoutCallback completes an RP-initiated logout once the IdP redirects
+// the browser back to us, mirroring the afterLogoutHandler pattern: it
+// just needs to confirm the state we signed in Logout comes back intact.
+// @Summary      Logout Callback
+// @Description  Validates the state returned by the IdP after RP-initiated logout
+// @Id 			 LogoutCallback
+// @Tags         Auth
+// @Produce      json
+// @Success      200  {string}  json "OK"
+// @Failure      400  {string}  json "Bad Request, state did not validate"
+// @Router       /web/logout/callback [get]
+func (o *OidcAgent) LogoutCallback(c *gin.Context) {
+	state := c.Query("state")
+	if _, ok := o.verifyLogoutState(state); !ok {
+		o.logger.Debug("logout callback state did not validate")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// BackchannelLogout handles an OIDC back-channel logout_token POSTed
+// directly by the IdP, per
+// https://openid.net/specs/openid-connect-backchannel-1_0.html. It evicts
+// any session the agent minted for the subject/IdP-session named in the
+// token, regardless of which browser started it.
+// @Summary      Backchannel Logout
+// @Description  Accepts a logout_token from the IdP and revokes matching sessions
+// @Id 			 BackchannelLogout
+// @Tags         Auth
+// @Accepts      x-www-form-urlencoded
+// @Success      200
+// @Failure      400  {string}  json "Bad Request, invalid logout_token"
+// @Router       /web/backchannel_logout [post]
+func (o *OidcAgent) BackchannelLogout(c *gin.Context) {
+	logoutToken := c.PostForm("logout_token")
+	if logoutToken == "" {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	ctx := o.prepareContext(c)
+	idToken, err := o.verifier.Verify(ctx, logoutToken)
+	if err != nil {
+		o.logger.With("error", err).Debug("unable to verify logout_token")
+		o.auditLog(c, "backchannel_logout", "failure", "reason", "invalid_logout_token")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	var claims struct {
+		Events map[string]interface{} `json:"events"`
+		Nonce  string                 `json:"nonce"`
+		SID    string                 `json:"sid"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		o.auditLog(c, "backchannel_logout", "failure", "reason", "invalid_claims")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	// A logout_token MUST NOT contain a nonce claim - RFC 8417/Backchannel
+	// Logout 1.0 forbid it to keep it from being confused with an ID token.
+	if claims.Nonce != "" {
+		o.logger.Debug("logout_token carried a nonce claim, rejecting")
+		o.auditLog(c, "backchannel_logout", "failure", "reason", "nonce_present")
+		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
 
-	logoutURL, err := o.LogoutURL(idToken.(string))
+	if _, ok := claims.Events[backchannelLogoutEvent]; !ok {
+		o.logger.Debug("logout_token missing backchannel-logout event")
+		o.auditLog(c, "backchannel_logout", "failure", "reason", "missing_event")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	sessionIDs, err := o.sessions.revoke(ctx, claims.SID, idToken.Subject)
 	if err != nil {
+		o.logger.With("error", err).Debug("unable to revoke sessions")
+		o.auditLog(c, "backchannel_logout", "failure", "reason", "revoke_failed")
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
+	for _, sessionID := range sessionIDs {
+		_ = o.sessionStore.Delete(ctx, sessionID)
+	}
+	o.logger.With(
+		"sub", idToken.Subject,
+		"sid", claims.SID,
+		"revoked_sessions", len(sessionIDs),
+	).Info("processed backchannel logout")
+	o.auditLog(c, "backchannel_logout", "success", "sub", idToken.Subject, "revoked_sessions", len(sessionIDs))
 
-	c.JSON(http.StatusOK, models.LogoutResponse{
-		LogoutURL: logoutURL.String(),
-	})
+	c.Status(http.StatusOK)
 }
 
 func (o *OidcAgent) CodeFlowProxy(c *gin.Context) {
-	session := ginsession.FromContext(c)
 	ctx := o.prepareContext(c)
-	tokenRaw, ok := session.Get(TokenKey)
+	sid, ok := o.sid(c)
 	if !ok {
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
-	token, err := JsonStringToToken(tokenRaw.(string))
+	data, err := o.sessionStore.Get(ctx, sid)
+	if err != nil {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	if data.Token == "" {
+		// Non-oidc connectors have no upstream API token to proxy with.
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	token, err := JsonStringToToken(data.Token)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
@@ -471,10 +717,19 @@ func (o *OidcAgent) CodeFlowProxy(c *gin.Context) {
 	proxy.ServeHTTP(c.Writer, c.Request)
 }
 
-func isLoggedIn(c *gin.Context) bool {
-	session := ginsession.FromContext(c)
-	_, ok := session.Get(TokenKey)
-	return ok
+func (o *OidcAgent) isLoggedIn(c *gin.Context) bool {
+	sid, ok := o.sid(c)
+	if !ok {
+		return false
+	}
+	if o.sessions.isRevoked(c.Request.Context(), sid) {
+		return false
+	}
+	data, err := o.sessionStore.Get(c.Request.Context(), sid)
+	if err != nil || data.Subject == "" {
+		return false
+	}
+	return true
 }
 
 // DeviceStart starts a device login request
@@ -491,6 +746,7 @@ func (o *OidcAgent) DeviceStart(c *gin.Context) {
 		DeviceAuthURL: o.deviceAuthURL,
 		Issuer:        o.oidcIssuer,
 		ClientID:      o.clientID,
+		PKCERequired:  o.requirePKCE,
 	})
 }
 
@@ -534,16 +790,48 @@ func JsonStringToToken(s string) (*oauth2.Token, error) {
 // @Failure      401  {object}  models.CheckAuthResponse "User is not authenticated."
 // @Router       /web/check_auth [get]
 func (o *OidcAgent) CheckAuth(c *gin.Context) {
-	session := ginsession.FromContext(c)
-
-	tokenRaw, ok := session.Get(TokenKey)
+	sid, ok := o.sid(c)
 	if !ok {
 		o.logger.Debug("Aborting with HTTP Status Unauthorized")
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 
-	token, err := JsonStringToToken(tokenRaw.(string))
+	if o.sessions.isRevoked(c.Request.Context(), sid) {
+		c.JSON(http.StatusUnauthorized, models.CheckAuthResponse{
+			Status:  "failure",
+			Message: "User is not authenticated.",
+		})
+		return
+	}
+
+	ctx := o.prepareContext(c)
+	data, err := o.sessionStore.Get(ctx, sid)
+	if err != nil {
+		o.logger.Debug("Aborting with HTTP Status Unauthorized")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if data.Token == "" {
+		// Connectors without an upstream oauth2 token have no expiry to
+		// check here - the session store entry existing is the whole
+		// story.
+		if data.Subject == "" {
+			c.JSON(http.StatusUnauthorized, models.CheckAuthResponse{
+				Status:  "failure",
+				Message: "User is not authenticated.",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, models.CheckAuthResponse{
+			Status:  "success",
+			Message: "User is authenticated.",
+		})
+		return
+	}
+
+	token, err := JsonStringToToken(data.Token)
 	if err != nil {
 		o.logger.Debug("Failed to decode token %v", err)
 		c.AbortWithStatus(http.StatusInternalServerError)
@@ -558,6 +846,22 @@ func (o *OidcAgent) CheckAuth(c *gin.Context) {
 		return
 	}
 
+	if o.strictIntrospection {
+		result, err := o.IntrospectToken(ctx, token.AccessToken)
+		if err != nil {
+			o.logger.With("error", err).Debug("token introspection failed")
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !result.Active {
+			c.JSON(http.StatusUnauthorized, models.CheckAuthResponse{
+				Status:  "failure",
+				Message: "User is not authenticated.",
+			})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, models.CheckAuthResponse{
 		Status:  "success",
 		Message: "User is authenticated.",
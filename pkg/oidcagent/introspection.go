@@ -0,0 +1,174 @@
+package oidcagent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultIntrospectionCacheTTL = 30 * time.Second
+
+// IntrospectionResponse is the subset of RFC 7662 fields this agent cares
+// about.
+type IntrospectionResponse struct {
+	Active   bool   `json:"active"`
+	Subject  string `json:"sub,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+}
+
+type introspectionCacheEntry struct {
+	response  IntrospectionResponse
+	expiresAt time.Time
+}
+
+type introspectionCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]introspectionCacheEntry
+}
+
+func newIntrospectionCache(ttl time.Duration) *introspectionCache {
+	if ttl <= 0 {
+		ttl = defaultIntrospectionCacheTTL
+	}
+	return &introspectionCache{ttl: ttl, entries: map[string]introspectionCacheEntry{}}
+}
+
+func (ic *introspectionCache) get(key string) (IntrospectionResponse, bool) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	entry, ok := ic.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return IntrospectionResponse{}, false
+	}
+	return entry.response, true
+}
+
+func (ic *introspectionCache) set(key string, resp IntrospectionResponse) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	ic.entries[key] = introspectionCacheEntry{response: resp, expiresAt: time.Now().Add(ic.ttl)}
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IntrospectToken implements RFC 7662 token introspection against the
+// provider's discovered introspection_endpoint. Responses are cached
+// briefly, keyed by a hash of the token, to avoid hammering the IdP on
+// every request when strict_introspection is enabled.
+func (o *OidcAgent) IntrospectToken(ctx context.Context, token string) (*IntrospectionResponse, error) {
+	if o.introspectionURL == "" {
+		return nil, fmt.Errorf("provider %s does not advertise an introspection_endpoint", o.oidcIssuer)
+	}
+
+	key := tokenHash(token)
+	if cached, ok := o.introspectionCache.get(key); ok {
+		return &cached, nil
+	}
+
+	form := url.Values{}
+	form.Set("token", token)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.introspectionURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(o.clientID, o.clientSecret)
+
+	resp, err := o.httpClient(ctx).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint returned %s: %s", resp.Status, body)
+	}
+
+	var result IntrospectionResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("unable to decode introspection response: %w", err)
+	}
+
+	o.introspectionCache.set(key, result)
+	return &result, nil
+}
+
+// RevokeToken implements RFC 7009 token revocation against the provider's
+// discovered revocation_endpoint. Errors are non-fatal to the caller's
+// teardown path - the IdP session is a secondary concern once the local
+// session is gone - but are returned so the caller can log them.
+func (o *OidcAgent) RevokeToken(ctx context.Context, token, tokenTypeHint string) error {
+	if o.revocationURL == "" {
+		return fmt.Errorf("provider %s does not advertise a revocation_endpoint", o.oidcIssuer)
+	}
+	if token == "" {
+		return nil
+	}
+
+	form := url.Values{}
+	form.Set("token", token)
+	if tokenTypeHint != "" {
+		form.Set("token_type_hint", tokenTypeHint)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.revocationURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(o.clientID, o.clientSecret)
+
+	resp, err := o.httpClient(ctx).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("revocation endpoint returned %s: %s", resp.Status, body)
+	}
+	return nil
+}
+
+// revokeSessionTokens revokes both the access and refresh tokens held in a
+// torn-down session. Failures are logged, not propagated - the IdP being
+// unreachable shouldn't stop a local logout/refresh-failure from
+// completing.
+func (o *OidcAgent) revokeSessionTokens(ctx context.Context, tokenString string) {
+	if o.revocationURL == "" || tokenString == "" {
+		return
+	}
+	token, err := JsonStringToToken(tokenString)
+	if err != nil {
+		return
+	}
+	if token.AccessToken != "" {
+		if err := o.RevokeToken(ctx, token.AccessToken, "access_token"); err != nil {
+			o.logger.With("error", err).Debug("failed to revoke access token")
+		}
+	}
+	if token.RefreshToken != "" {
+		if err := o.RevokeToken(ctx, token.RefreshToken, "refresh_token"); err != nil {
+			o.logger.With("error", err).Debug("failed to revoke refresh token")
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package oidcagent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIntrospectionCacheGetSet(t *testing.T) {
+	ic := newIntrospectionCache(time.Minute)
+
+	if _, ok := ic.get("missing"); ok {
+		t.Fatal("get on an empty cache should miss")
+	}
+
+	want := IntrospectionResponse{Active: true, Subject: "alice"}
+	ic.set("key", want)
+
+	got, ok := ic.get("key")
+	if !ok {
+		t.Fatal("expected a cache hit after set")
+	}
+	if got != want {
+		t.Errorf("get = %+v, want %+v", got, want)
+	}
+}
+
+func TestIntrospectionCacheExpiry(t *testing.T) {
+	ic := newIntrospectionCache(time.Millisecond)
+	ic.set("key", IntrospectionResponse{Active: true})
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := ic.get("key"); ok {
+		t.Fatal("expected entry to have expired")
+	}
+}
+
+func TestNewIntrospectionCacheDefaultsTTL(t *testing.T) {
+	ic := newIntrospectionCache(0)
+	if ic.ttl != defaultIntrospectionCacheTTL {
+		t.Errorf("ttl = %v, want default %v", ic.ttl, defaultIntrospectionCacheTTL)
+	}
+}
+
+func TestTokenHashIsStableAndDistinct(t *testing.T) {
+	a := tokenHash("token-a")
+	b := tokenHash("token-a")
+	c := tokenHash("token-b")
+
+	if a != b {
+		t.Error("tokenHash should be deterministic for the same input")
+	}
+	if a == c {
+		t.Error("tokenHash should differ for different inputs")
+	}
+	if a == "token-a" {
+		t.Error("tokenHash should not return the raw token")
+	}
+}
@@ -0,0 +1,255 @@
+package oidcagent
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// backchannelLogoutEvent is the event type an IdP sets in a logout_token's
+// "events" claim, per
+// https://openid.net/specs/openid-connect-backchannel-1_0.html#LogoutToken
+const backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// sessionRegistryMaxAge bounds how long a registration - and the revoked
+// flag it may carry - is kept if the session it belongs to is never cleanly
+// logged out or refreshed (e.g. the browser is simply closed). unregister()
+// is the normal teardown path; this is just a backstop so an abandoned
+// session doesn't stay in the store forever.
+const sessionRegistryMaxAge = 24 * time.Hour
+
+// PendingStore keys used by sessionRegistry, namespaced from the connectors'
+// own login-pending keys since they all share the same store.
+const (
+	idpSIDIndexPrefix = "logout:idpsid:"
+	subIndexPrefix    = "logout:sub:"
+	sessionRefPrefix  = "logout:sessionref:"
+	revokedSetKey     = "logout:revoked"
+)
+
+// sessionRegistry tracks the mapping between an IdP session (sid claim) or
+// subject (sub claim) and the local session IDs minted for them, so that a
+// back-channel logout_token - which never touches the user's browser - can
+// still find and evict the right sessions. It's backed by a PendingStore,
+// the same one connectors track pending logins in, so the index is visible
+// to every replica and a BackchannelLogout landing on a different instance
+// than the one that registered the session can still find it.
+type sessionRegistry struct {
+	store  PendingStore
+	logger *zap.SugaredLogger
+}
+
+func newSessionRegistry(store PendingStore, logger *zap.SugaredLogger) *sessionRegistry {
+	return &sessionRegistry{store: store, logger: logger}
+}
+
+// sessionRef is the reverse index stored per session ID, so unregister and
+// rekey - which are only ever called with a bare session ID, never the
+// idpSID/sub it was registered under - can find which index sets to remove
+// it from.
+type sessionRef struct {
+	IdpSID string
+	Sub    string
+}
+
+func (r *sessionRegistry) register(ctx context.Context, idpSID, sub, sessionID string) {
+	if idpSID == "" && sub == "" {
+		return
+	}
+	if idpSID != "" {
+		if err := r.store.AddMember(ctx, idpSIDIndexPrefix+idpSID, sessionID, sessionRegistryMaxAge); err != nil {
+			r.logger.With("error", err).Debug("failed to index session by idp sid")
+		}
+	}
+	if sub != "" {
+		if err := r.store.AddMember(ctx, subIndexPrefix+sub, sessionID, sessionRegistryMaxAge); err != nil {
+			r.logger.With("error", err).Debug("failed to index session by subject")
+		}
+	}
+	ref, err := json.Marshal(sessionRef{IdpSID: idpSID, Sub: sub})
+	if err != nil {
+		r.logger.With("error", err).Debug("failed to marshal session reverse index")
+		return
+	}
+	if err := r.store.Save(ctx, sessionRefPrefix+sessionID, ref, sessionRegistryMaxAge); err != nil {
+		r.logger.With("error", err).Debug("failed to save session reverse index")
+	}
+}
+
+// takeSessionRef reads and removes the reverse index stored for sessionID,
+// if any.
+func (r *sessionRegistry) takeSessionRef(ctx context.Context, sessionID string) (sessionRef, bool) {
+	raw, ok, err := r.store.Take(ctx, sessionRefPrefix+sessionID)
+	if err != nil {
+		r.logger.With("error", err).Debug("failed to read session reverse index")
+		return sessionRef{}, false
+	}
+	if !ok {
+		return sessionRef{}, false
+	}
+	var ref sessionRef
+	if err := json.Unmarshal(raw, &ref); err != nil {
+		r.logger.With("error", err).Debug("failed to decode session reverse index")
+		return sessionRef{}, false
+	}
+	return ref, true
+}
+
+// rekey moves every registration held under oldSessionID to newSessionID,
+// used when Refresh rotates the session ID.
+func (r *sessionRegistry) rekey(ctx context.Context, oldSessionID, newSessionID string) {
+	if ref, ok := r.takeSessionRef(ctx, oldSessionID); ok {
+		if ref.IdpSID != "" {
+			_ = r.store.RemoveMember(ctx, idpSIDIndexPrefix+ref.IdpSID, oldSessionID)
+			if err := r.store.AddMember(ctx, idpSIDIndexPrefix+ref.IdpSID, newSessionID, sessionRegistryMaxAge); err != nil {
+				r.logger.With("error", err).Debug("failed to re-index session by idp sid")
+			}
+		}
+		if ref.Sub != "" {
+			_ = r.store.RemoveMember(ctx, subIndexPrefix+ref.Sub, oldSessionID)
+			if err := r.store.AddMember(ctx, subIndexPrefix+ref.Sub, newSessionID, sessionRegistryMaxAge); err != nil {
+				r.logger.With("error", err).Debug("failed to re-index session by subject")
+			}
+		}
+		newRef, err := json.Marshal(ref)
+		if err != nil {
+			r.logger.With("error", err).Debug("failed to marshal session reverse index")
+		} else if err := r.store.Save(ctx, sessionRefPrefix+newSessionID, newRef, sessionRegistryMaxAge); err != nil {
+			r.logger.With("error", err).Debug("failed to save session reverse index")
+		}
+	}
+
+	revoked, err := r.store.IsMember(ctx, revokedSetKey, oldSessionID)
+	if err != nil {
+		r.logger.With("error", err).Debug("failed to check revoked status")
+		return
+	}
+	if !revoked {
+		return
+	}
+	_ = r.store.RemoveMember(ctx, revokedSetKey, oldSessionID)
+	if err := r.store.AddMember(ctx, revokedSetKey, newSessionID, sessionRegistryMaxAge); err != nil {
+		r.logger.With("error", err).Debug("failed to carry revoked flag to new session id")
+	}
+}
+
+func (r *sessionRegistry) unregister(ctx context.Context, sessionID string) {
+	if ref, ok := r.takeSessionRef(ctx, sessionID); ok {
+		if ref.IdpSID != "" {
+			_ = r.store.RemoveMember(ctx, idpSIDIndexPrefix+ref.IdpSID, sessionID)
+		}
+		if ref.Sub != "" {
+			_ = r.store.RemoveMember(ctx, subIndexPrefix+ref.Sub, sessionID)
+		}
+	}
+	_ = r.store.RemoveMember(ctx, revokedSetKey, sessionID)
+}
+
+// revoke marks every session registered under idpSID and/or sub as revoked
+// and returns their local session IDs.
+func (r *sessionRegistry) revoke(ctx context.Context, idpSID, sub string) ([]string, error) {
+	seen := map[string]struct{}{}
+	if idpSID != "" {
+		members, err := r.store.Members(ctx, idpSIDIndexPrefix+idpSID)
+		if err != nil {
+			return nil, fmt.Errorf("session registry: unable to look up sessions by idp sid: %w", err)
+		}
+		for _, sid := range members {
+			seen[sid] = struct{}{}
+		}
+	}
+	if sub != "" {
+		members, err := r.store.Members(ctx, subIndexPrefix+sub)
+		if err != nil {
+			return nil, fmt.Errorf("session registry: unable to look up sessions by subject: %w", err)
+		}
+		for _, sid := range members {
+			seen[sid] = struct{}{}
+		}
+	}
+
+	// Mark every session revoked on a best-effort basis: one session's
+	// store error shouldn't stop the rest of the batch from being
+	// revoked, or make the caller believe no sessions that already got
+	// revoked need to be evicted from the SessionStore.
+	sessionIDs := make([]string, 0, len(seen))
+	for sid := range seen {
+		if err := r.store.AddMember(ctx, revokedSetKey, sid, sessionRegistryMaxAge); err != nil {
+			r.logger.With("error", err, "session_id", sid).Debug("failed to mark session revoked")
+			continue
+		}
+		sessionIDs = append(sessionIDs, sid)
+	}
+	return sessionIDs, nil
+}
+
+// isRevoked fails closed: if the store can't be reached, a session is
+// treated as revoked rather than risk honoring a request with a session a
+// backchannel logout already asked to evict.
+func (r *sessionRegistry) isRevoked(ctx context.Context, sessionID string) bool {
+	revoked, err := r.store.IsMember(ctx, revokedSetKey, sessionID)
+	if err != nil {
+		r.logger.With("error", err).Debug("failed to check revoked status, treating session as revoked")
+		return true
+	}
+	return revoked
+}
+
+// signLogoutState produces an HMAC-signed token binding a logout attempt to
+// the session that initiated it, so /web/logout/callback can tell a
+// legitimate IdP redirect apart from a forged one.
+func (o *OidcAgent) signLogoutState(sessionID string) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	payload := sessionID + "." + base64.RawURLEncoding.EncodeToString(nonce)
+
+	mac := hmac.New(sha256.New, o.logoutHMACKey)
+	mac.Write([]byte(payload))
+	sig := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	return payload + "." + sig, nil
+}
+
+// verifyLogoutState checks the token minted by signLogoutState and returns
+// the session ID it was bound to.
+func (o *OidcAgent) verifyLogoutState(token string) (string, bool) {
+	parts := splitSignedToken(token)
+	if len(parts) != 3 {
+		return "", false
+	}
+	sessionID, nonce, sig := parts[0], parts[1], parts[2]
+
+	mac := hmac.New(sha256.New, o.logoutHMACKey)
+	mac.Write([]byte(sessionID + "." + nonce))
+	expected := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		return "", false
+	}
+	return sessionID, true
+}
+
+// splitSignedToken splits a dot-delimited signed token, shared by the
+// logout-state and login-req tokens.
+func splitSignedToken(token string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(token); i++ {
+		if token[i] == '.' {
+			parts = append(parts, token[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, token[start:])
+	return parts
+}
@@ -0,0 +1,194 @@
+package oidcagent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestSessionRegistry() *sessionRegistry {
+	return newSessionRegistry(NewMemoryPendingStore(), zap.NewNop().Sugar())
+}
+
+// erroringPendingStore fails every call, to exercise how sessionRegistry
+// reacts when the shared store is unreachable.
+type erroringPendingStore struct{}
+
+func (erroringPendingStore) Save(context.Context, string, []byte, time.Duration) error {
+	return errors.New("store unreachable")
+}
+
+func (erroringPendingStore) Take(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errors.New("store unreachable")
+}
+
+func (erroringPendingStore) AddMember(context.Context, string, string, time.Duration) error {
+	return errors.New("store unreachable")
+}
+
+func (erroringPendingStore) RemoveMember(context.Context, string, string) error {
+	return errors.New("store unreachable")
+}
+
+func (erroringPendingStore) Members(context.Context, string) ([]string, error) {
+	return nil, errors.New("store unreachable")
+}
+
+func (erroringPendingStore) IsMember(context.Context, string, string) (bool, error) {
+	return false, errors.New("store unreachable")
+}
+
+func newTestAgentForLogout() *OidcAgent {
+	return &OidcAgent{
+		logoutHMACKey:   []byte("0123456789abcdef0123456789abcdef"),
+		loginReqHMACKey: []byte("fedcba9876543210fedcba9876543210"),
+		sessions:        newTestSessionRegistry(),
+	}
+}
+
+func TestSignAndVerifyLogoutStateRoundTrip(t *testing.T) {
+	o := newTestAgentForLogout()
+
+	token, err := o.signLogoutState("session-1")
+	if err != nil {
+		t.Fatalf("signLogoutState: %v", err)
+	}
+
+	sessionID, ok := o.verifyLogoutState(token)
+	if !ok {
+		t.Fatal("verifyLogoutState rejected a token it signed")
+	}
+	if sessionID != "session-1" {
+		t.Errorf("sessionID = %q, want %q", sessionID, "session-1")
+	}
+}
+
+func TestVerifyLogoutStateRejectsTamperedToken(t *testing.T) {
+	o := newTestAgentForLogout()
+
+	token, err := o.signLogoutState("session-1")
+	if err != nil {
+		t.Fatalf("signLogoutState: %v", err)
+	}
+
+	parts := splitSignedToken(token)
+	tampered := "session-2." + parts[1] + "." + parts[2]
+
+	if _, ok := o.verifyLogoutState(tampered); ok {
+		t.Fatal("verifyLogoutState accepted a token with a tampered session ID")
+	}
+}
+
+func TestVerifyLogoutStateRejectsGarbage(t *testing.T) {
+	o := newTestAgentForLogout()
+	if _, ok := o.verifyLogoutState("not-a-valid-token"); ok {
+		t.Fatal("verifyLogoutState accepted a malformed token")
+	}
+}
+
+func TestSplitSignedToken(t *testing.T) {
+	got := splitSignedToken("a.b.c")
+	want := []string{"a", "b", "c"}
+	if len(got) != len(want) {
+		t.Fatalf("splitSignedToken returned %d parts, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("part %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSessionRegistryRegisterAndRevoke(t *testing.T) {
+	r := newTestSessionRegistry()
+	ctx := context.Background()
+
+	r.register(ctx, "idp-sid-1", "alice", "local-1")
+	r.register(ctx, "idp-sid-1", "alice", "local-2")
+
+	if r.isRevoked(ctx, "local-1") {
+		t.Fatal("session should not be revoked yet")
+	}
+
+	revoked, err := r.revoke(ctx, "idp-sid-1", "")
+	if err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if len(revoked) != 2 {
+		t.Fatalf("revoke returned %d session IDs, want 2", len(revoked))
+	}
+	if !r.isRevoked(ctx, "local-1") || !r.isRevoked(ctx, "local-2") {
+		t.Fatal("both sessions registered under the idp sid should be revoked")
+	}
+}
+
+func TestSessionRegistryRevokeBySubject(t *testing.T) {
+	r := newTestSessionRegistry()
+	ctx := context.Background()
+	r.register(ctx, "", "alice", "local-1")
+
+	revoked, err := r.revoke(ctx, "", "alice")
+	if err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if len(revoked) != 1 || revoked[0] != "local-1" {
+		t.Fatalf("revoke(sub) = %v, want [local-1]", revoked)
+	}
+}
+
+func TestSessionRegistryUnregister(t *testing.T) {
+	r := newTestSessionRegistry()
+	ctx := context.Background()
+	r.register(ctx, "idp-sid-1", "alice", "local-1")
+	r.unregister(ctx, "local-1")
+
+	revoked, err := r.revoke(ctx, "idp-sid-1", "")
+	if err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if len(revoked) != 0 {
+		t.Fatalf("revoke after unregister = %v, want none", revoked)
+	}
+}
+
+func TestSessionRegistryRekeyPreservesRevokedStatus(t *testing.T) {
+	r := newTestSessionRegistry()
+	ctx := context.Background()
+	r.register(ctx, "idp-sid-1", "alice", "old-session")
+	if _, err := r.revoke(ctx, "idp-sid-1", ""); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+
+	r.rekey(ctx, "old-session", "new-session")
+
+	if r.isRevoked(ctx, "old-session") {
+		t.Error("old session ID should no longer be tracked as revoked")
+	}
+	if !r.isRevoked(ctx, "new-session") {
+		t.Error("rekey should carry the revoked flag over to the new session ID")
+	}
+
+	revoked, err := r.revoke(ctx, "idp-sid-1", "")
+	if err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	found := false
+	for _, sid := range revoked {
+		if sid == "new-session" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("rekey should carry the idp sid index over to the new session ID")
+	}
+}
+
+func TestSessionRegistryIsRevokedFailsClosedOnStoreError(t *testing.T) {
+	r := newSessionRegistry(erroringPendingStore{}, zap.NewNop().Sugar())
+	if !r.isRevoked(context.Background(), "some-session") {
+		t.Error("isRevoked should treat a session as revoked when the store can't be reached")
+	}
+}
@@ -0,0 +1,53 @@
+// Package models contains the request/response payloads exchanged between
+// the frontend/CLI and the oidcagent HTTP handlers.
+package models
+
+// LoginStartResponse is returned by LoginStart
+type LoginStartResponse struct {
+	AuthorizationRequestURL string `json:"authorization_request_url"`
+}
+
+// LoginEndRequest is the body of the LoginEnd request
+type LoginEndRequest struct {
+	RequestURL string `json:"request_url"`
+}
+
+// LoginEndResponse is returned by LoginEnd
+type LoginEndResponse struct {
+	Handled  bool `json:"handled"`
+	LoggedIn bool `json:"logged_in"`
+}
+
+// UserInfoResponse is returned by UserInfo
+type UserInfoResponse struct {
+	Subject           string `json:"subject"`
+	PreferredUsername string `json:"preferred_username"`
+	Email             string `json:"email,omitempty"`
+	GivenName         string `json:"given_name"`
+	FamilyName        string `json:"family_name"`
+	Picture           string `json:"picture"`
+	UpdatedAt         int64  `json:"updated_at"`
+}
+
+// LogoutResponse is returned by Logout
+type LogoutResponse struct {
+	LogoutURL string `json:"logout_url"`
+}
+
+// DeviceStartResponse is returned by DeviceStart
+type DeviceStartResponse struct {
+	DeviceAuthURL string `json:"device_auth_url"`
+	Issuer        string `json:"issuer"`
+	ClientID      string `json:"client_id"`
+	// PKCERequired tells the CLI it must generate its own code_verifier,
+	// send code_challenge/code_challenge_method=S256 on the device
+	// authorization request, and replay the verifier on the token
+	// request.
+	PKCERequired bool `json:"pkce_required"`
+}
+
+// CheckAuthResponse is returned by CheckAuth
+type CheckAuthResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,269 @@
+package oidcagent
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// Options configures a new OidcAgent.
+type Options struct {
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	Issuer        string
+	DeviceAuthURL string
+	Backend       string
+	InsecureTLS   bool
+	// RequirePKCE forces a PKCE (RFC 7636) code_verifier/code_challenge
+	// pair on every authorization code flow, even if the upstream IdP
+	// advertises it as optional.
+	RequirePKCE bool
+	// PostLogoutRedirectURL is sent to the IdP as post_logout_redirect_uri
+	// on RP-initiated logout.
+	PostLogoutRedirectURL string
+	// LogoutHMACKey signs the state sent with RP-initiated logout so
+	// /web/logout/callback can be sure the IdP redirect corresponds to a
+	// logout this agent started. A random key is generated if left empty,
+	// which is fine for a single instance but won't validate across a
+	// restart or a second replica.
+	LogoutHMACKey []byte
+	// LoginReqHMACKey signs the "req" token embedded as state/RelayState
+	// on every login, which names the connector a callback should
+	// dispatch to. A random key is generated if left empty, with the same
+	// multi-replica caveat as LogoutHMACKey.
+	LoginReqHMACKey []byte
+	// LoginCallbackURL is the redirect/ACS URL connectors send the IdP
+	// back to - typically this agent's own /web/login/callback.
+	LoginCallbackURL string
+	// PostLoginRedirectURL is where LoginCallback sends the browser after
+	// a connector that completes login via a full-page redirect (SAML,
+	// static, ldap) rather than the frontend's fetch-based /web/login/end.
+	PostLoginRedirectURL string
+	// Connectors are the non-OIDC identity sources available alongside
+	// the always-registered "oidc" connector, e.g. an LDAPConnector or
+	// StaticConnector. Registering two connectors with the same ID is an
+	// error.
+	Connectors []Connector
+	// StrictIntrospection makes CheckAuth call IntrospectToken on every
+	// request instead of only checking local token expiry, so a token
+	// revoked at the IdP is reported as unauthenticated even if it
+	// hasn't expired yet.
+	StrictIntrospection bool
+	// IntrospectionCacheTTL bounds how long an introspection result is
+	// reused before IntrospectToken hits the IdP again. Defaults to 30s.
+	IntrospectionCacheTTL time.Duration
+	// SessionStore persists token material server-side, keyed by the
+	// opaque session ID the browser receives. Required.
+	SessionStore SessionStore
+	// PendingStore persists the short-lived state a login or backchannel
+	// logout needs to survive a request landing on a different replica
+	// than the one that handled the request before it: the nonce/
+	// code_verifier/AuthnRequest ID tracked between LoginURL and
+	// HandleCallback, and the idpSID/sub -> session index backchannel
+	// logout uses to evict sessions. Defaults to a process-local
+	// MemoryPendingStore, which only works for a single replica; set this
+	// to a RedisPendingStore for anything behind a load balancer. Pass the
+	// same store to any externally-constructed Connector that also takes
+	// one, e.g. NewSAML2Connector.
+	PendingStore PendingStore
+	// ClientRemoteIP configures how the real client IP is resolved for
+	// audit logging when the agent runs behind an ingress/load balancer.
+	ClientRemoteIP ClientRemoteIPConfig
+	Logger         *zap.SugaredLogger
+}
+
+// OidcAgent proxies authentication to an upstream OIDC provider on behalf of
+// the frontend and CLI, keeping tokens server-side rather than in the
+// browser.
+type OidcAgent struct {
+	logger        *zap.SugaredLogger
+	oauthConfig   *oauth2.Config
+	provider      *oidc.Provider
+	verifier      *oidc.IDTokenVerifier
+	insecureTLS   bool
+	backend       *url.URL
+	clientID      string
+	clientSecret  string
+	oidcIssuer    string
+	deviceAuthURL string
+	endSessionURL string
+	requirePKCE   bool
+
+	postLogoutRedirectURL string
+	logoutHMACKey         []byte
+	sessions              *sessionRegistry
+
+	loginReqHMACKey      []byte
+	loginCallbackURL     string
+	postLoginRedirectURL string
+	connectors           map[string]Connector
+
+	introspectionURL    string
+	revocationURL       string
+	strictIntrospection bool
+	introspectionCache  *introspectionCache
+
+	sessionStore SessionStore
+
+	clientIPHeader string
+	trustedProxies *trustedProxies
+}
+
+// providerClaims carries the discovery document fields the go-oidc package
+// doesn't surface directly.
+type providerClaims struct {
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
+	RevocationEndpoint    string `json:"revocation_endpoint"`
+}
+
+// NewOidcAgent discovers the given issuer and builds an OidcAgent ready to
+// handle the web and device login flows.
+func NewOidcAgent(ctx context.Context, options Options) (*OidcAgent, error) {
+	backend, err := url.Parse(options.Backend)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backend url: %w", err)
+	}
+
+	provider, err := oidc.NewProvider(ctx, options.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover oidc provider: %w", err)
+	}
+
+	var claims providerClaims
+	if err := provider.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to parse oidc discovery document: %w", err)
+	}
+
+	oauthConfig := &oauth2.Config{
+		ClientID:     options.ClientID,
+		ClientSecret: options.ClientSecret,
+		RedirectURL:  options.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+	}
+
+	verifier := provider.Verifier(&oidc.Config{ClientID: options.ClientID})
+
+	hmacKey := options.LogoutHMACKey
+	if len(hmacKey) == 0 {
+		hmacKey = make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, hmacKey); err != nil {
+			return nil, fmt.Errorf("failed to generate logout hmac key: %w", err)
+		}
+	}
+
+	loginReqHMACKey := options.LoginReqHMACKey
+	if len(loginReqHMACKey) == 0 {
+		loginReqHMACKey = make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, loginReqHMACKey); err != nil {
+			return nil, fmt.Errorf("failed to generate login req hmac key: %w", err)
+		}
+	}
+
+	if options.SessionStore == nil {
+		return nil, fmt.Errorf("a SessionStore is required")
+	}
+
+	trustedProxies, err := newTrustedProxies(options.ClientRemoteIP.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	pendingStore := options.PendingStore
+	if pendingStore == nil {
+		pendingStore = NewMemoryPendingStore()
+	}
+
+	connectors := map[string]Connector{}
+	oidcConn := newOIDCConnector(oauthConfig, verifier, options.RequirePKCE, pendingStore)
+	connectors[oidcConn.ID()] = oidcConn
+	for _, conn := range options.Connectors {
+		if _, exists := connectors[conn.ID()]; exists {
+			return nil, fmt.Errorf("duplicate connector id %q", conn.ID())
+		}
+		connectors[conn.ID()] = conn
+	}
+
+	return &OidcAgent{
+		logger:                options.Logger,
+		oauthConfig:           oauthConfig,
+		provider:              provider,
+		verifier:              verifier,
+		insecureTLS:           options.InsecureTLS,
+		backend:               backend,
+		clientID:              options.ClientID,
+		clientSecret:          options.ClientSecret,
+		oidcIssuer:            options.Issuer,
+		deviceAuthURL:         options.DeviceAuthURL,
+		endSessionURL:         claims.EndSessionEndpoint,
+		requirePKCE:           options.RequirePKCE,
+		postLogoutRedirectURL: options.PostLogoutRedirectURL,
+		logoutHMACKey:         hmacKey,
+		sessions:              newSessionRegistry(pendingStore, options.Logger),
+		loginReqHMACKey:       loginReqHMACKey,
+		loginCallbackURL:      options.LoginCallbackURL,
+		postLoginRedirectURL:  options.PostLoginRedirectURL,
+		connectors:            connectors,
+		introspectionURL:      claims.IntrospectionEndpoint,
+		revocationURL:         claims.RevocationEndpoint,
+		strictIntrospection:   options.StrictIntrospection,
+		introspectionCache:    newIntrospectionCache(options.IntrospectionCacheTTL),
+		sessionStore:          options.SessionStore,
+		clientIPHeader:        options.ClientRemoteIP.Header,
+		trustedProxies:        trustedProxies,
+	}, nil
+}
+
+// httpClient returns an *http.Client suitable for talking directly to the
+// provider's non-discovery endpoints (introspection, revocation),
+// respecting the same insecureTLS setting used for the OIDC flows.
+func (o *OidcAgent) httpClient(_ context.Context) *http.Client {
+	if !o.insecureTLS {
+		return http.DefaultClient
+	}
+	// #nosec: G402
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+}
+
+// LogoutURL builds the RP-initiated end-session URL for the given id_token
+// and local session, per
+// https://openid.net/specs/openid-connect-rpinitiated-1_0.html. The
+// returned state is signed so /web/logout/callback can confirm the
+// redirect corresponds to a logout this agent started.
+func (o *OidcAgent) LogoutURL(idToken, sessionID string) (*url.URL, error) {
+	if o.endSessionURL == "" {
+		return nil, fmt.Errorf("provider %s does not advertise an end_session_endpoint", o.oidcIssuer)
+	}
+
+	state, err := o.signLogoutState(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	logoutURL, err := url.Parse(o.endSessionURL)
+	if err != nil {
+		return nil, err
+	}
+
+	q := logoutURL.Query()
+	q.Set("id_token_hint", idToken)
+	q.Set("client_id", o.clientID)
+	q.Set("state", state)
+	if o.postLogoutRedirectURL != "" {
+		q.Set("post_logout_redirect_uri", o.postLogoutRedirectURL)
+	}
+	logoutURL.RawQuery = q.Encode()
+
+	return logoutURL, nil
+}
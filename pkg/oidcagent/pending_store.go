@@ -0,0 +1,145 @@
+package oidcagent
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// PendingStore persists state that must survive a request landing on a
+// different oidcagent replica than the one that handled the request before
+// it: the nonce/code_verifier/AuthnRequest ID a connector tracks between
+// LoginURL and HandleCallback, and the idpSID/sub -> session index
+// sessionRegistry needs so BackchannelLogout can evict a session no matter
+// which replica minted it. It's the same cross-replica requirement
+// SessionStore exists for, just for data that isn't a full logged-in
+// session.
+type PendingStore interface {
+	// Save stores value under key, readable by Take until ttl elapses.
+	Save(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Take reads and removes the value stored under key. ok is false if
+	// nothing is stored under key, including because it already expired.
+	Take(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// AddMember adds member to the set stored under key, creating the set
+	// if necessary. member stops counting towards Members/IsMember once
+	// ttl elapses from this call.
+	AddMember(ctx context.Context, key, member string, ttl time.Duration) error
+	// RemoveMember removes member from the set stored under key, if present.
+	RemoveMember(ctx context.Context, key, member string) error
+	// Members returns every non-expired member currently stored under key.
+	Members(ctx context.Context, key string) ([]string, error)
+	// IsMember reports whether member is currently in the set stored under key.
+	IsMember(ctx context.Context, key, member string) (bool, error)
+}
+
+// MemoryPendingStore is the zero-config PendingStore: a process-local map.
+// It's fine for a single replica; a login or backchannel logout that lands
+// on a different instance than the one that created the matching state
+// won't find it there - use a RedisPendingStore once there's more than one
+// replica behind a load balancer.
+type MemoryPendingStore struct {
+	mu      sync.Mutex
+	values  map[string]memoryPendingValue
+	members map[string]map[string]time.Time
+}
+
+type memoryPendingValue struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// NewMemoryPendingStore builds a MemoryPendingStore.
+func NewMemoryPendingStore() *MemoryPendingStore {
+	return &MemoryPendingStore{
+		values:  map[string]memoryPendingValue{},
+		members: map[string]map[string]time.Time{},
+	}
+}
+
+func (m *MemoryPendingStore) Save(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweepValuesLocked()
+	m.values[key] = memoryPendingValue{data: value, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (m *MemoryPendingStore) Take(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.values[key]
+	delete(m.values, key)
+	if !ok || time.Now().After(v.expiresAt) {
+		return nil, false, nil
+	}
+	return v.data, true, nil
+}
+
+func (m *MemoryPendingStore) AddMember(_ context.Context, key, member string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweepMembersLocked()
+	if m.members[key] == nil {
+		m.members[key] = map[string]time.Time{}
+	}
+	m.members[key][member] = time.Now().Add(ttl)
+	return nil
+}
+
+func (m *MemoryPendingStore) RemoveMember(_ context.Context, key, member string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.members[key], member)
+	return nil
+}
+
+func (m *MemoryPendingStore) Members(_ context.Context, key string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	members := make([]string, 0, len(m.members[key]))
+	for member, expiresAt := range m.members[key] {
+		if now.After(expiresAt) {
+			continue
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func (m *MemoryPendingStore) IsMember(_ context.Context, key, member string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	expiresAt, ok := m.members[key][member]
+	if !ok || time.Now().After(expiresAt) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// sweepValuesLocked evicts expired single values. Callers must hold m.mu.
+func (m *MemoryPendingStore) sweepValuesLocked() {
+	now := time.Now()
+	for key, v := range m.values {
+		if now.After(v.expiresAt) {
+			delete(m.values, key)
+		}
+	}
+}
+
+// sweepMembersLocked evicts expired set members. Callers must hold m.mu.
+func (m *MemoryPendingStore) sweepMembersLocked() {
+	now := time.Now()
+	for key, members := range m.members {
+		for member, expiresAt := range members {
+			if now.After(expiresAt) {
+				delete(members, member)
+			}
+		}
+		if len(members) == 0 {
+			delete(m.members, key)
+		}
+	}
+}
+
+var _ PendingStore = (*MemoryPendingStore)(nil)
@@ -0,0 +1,81 @@
+package oidcagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisPendingStore is a PendingStore backed by Redis, for deployments
+// running more than one oidcagent replica - the same reason RedisStore
+// exists for SessionStore.
+type RedisPendingStore struct {
+	client *redis.Client
+}
+
+// NewRedisPendingStore returns a RedisPendingStore.
+func NewRedisPendingStore(client *redis.Client) *RedisPendingStore {
+	return &RedisPendingStore{client: client}
+}
+
+func (s *RedisPendingStore) valueKey(key string) string { return "oidcagent:pending:" + key }
+func (s *RedisPendingStore) setKey(key string) string   { return "oidcagent:pending-set:" + key }
+
+func (s *RedisPendingStore) Save(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, s.valueKey(key), value, ttl).Err()
+}
+
+func (s *RedisPendingStore) Take(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.GetDel(ctx, s.valueKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// AddMember scores member by its expiry so Members/IsMember can filter out
+// anything past ttl without a separate per-member key, then refreshes the
+// whole set's own TTL so an abandoned set doesn't linger in Redis forever.
+func (s *RedisPendingStore) AddMember(ctx context.Context, key, member string, ttl time.Duration) error {
+	k := s.setKey(key)
+	score := float64(time.Now().Add(ttl).Unix())
+	if err := s.client.ZAdd(ctx, k, redis.Z{Score: score, Member: member}).Err(); err != nil {
+		return err
+	}
+	return s.client.Expire(ctx, k, ttl).Err()
+}
+
+func (s *RedisPendingStore) RemoveMember(ctx context.Context, key, member string) error {
+	return s.client.ZRem(ctx, s.setKey(key), member).Err()
+}
+
+func (s *RedisPendingStore) Members(ctx context.Context, key string) ([]string, error) {
+	now := float64(time.Now().Unix())
+	members, err := s.client.ZRangeByScore(ctx, s.setKey(key), &redis.ZRangeBy{
+		Min: fmt.Sprintf("%f", now),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (s *RedisPendingStore) IsMember(ctx context.Context, key, member string) (bool, error) {
+	score, err := s.client.ZScore(ctx, s.setKey(key), member).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return score > float64(time.Now().Unix()), nil
+}
+
+var _ PendingStore = (*RedisPendingStore)(nil)
@@ -0,0 +1,75 @@
+package oidcagent
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryPendingStoreSaveAndTake(t *testing.T) {
+	s := NewMemoryPendingStore()
+	ctx := context.Background()
+
+	if err := s.Save(ctx, "key", []byte("value"), time.Minute); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	value, ok, err := s.Take(ctx, "key")
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if !ok || string(value) != "value" {
+		t.Fatalf("Take = (%q, %v), want (\"value\", true)", value, ok)
+	}
+
+	if _, ok, _ := s.Take(ctx, "key"); ok {
+		t.Error("Take should not return a value once it's already been taken")
+	}
+}
+
+func TestMemoryPendingStoreTakeExpired(t *testing.T) {
+	s := NewMemoryPendingStore()
+	ctx := context.Background()
+
+	if err := s.Save(ctx, "key", []byte("value"), -time.Second); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	if _, ok, _ := s.Take(ctx, "key"); ok {
+		t.Error("expected Take to report a value expired before it was ever read as absent")
+	}
+}
+
+func TestMemoryPendingStoreMembers(t *testing.T) {
+	s := NewMemoryPendingStore()
+	ctx := context.Background()
+
+	if err := s.AddMember(ctx, "set", "stale", -time.Minute); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+	if err := s.AddMember(ctx, "set", "fresh", time.Minute); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+
+	members, err := s.Members(ctx, "set")
+	if err != nil {
+		t.Fatalf("Members: %v", err)
+	}
+	if len(members) != 1 || members[0] != "fresh" {
+		t.Errorf("Members = %v, want [fresh]", members)
+	}
+
+	if isMember, _ := s.IsMember(ctx, "set", "stale"); isMember {
+		t.Error("expired member should not report as a member")
+	}
+	if isMember, _ := s.IsMember(ctx, "set", "fresh"); !isMember {
+		t.Error("non-expired member should report as a member")
+	}
+
+	if err := s.RemoveMember(ctx, "set", "fresh"); err != nil {
+		t.Fatalf("RemoveMember: %v", err)
+	}
+	if isMember, _ := s.IsMember(ctx, "set", "fresh"); isMember {
+		t.Error("removed member should no longer report as a member")
+	}
+}
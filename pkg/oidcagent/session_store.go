@@ -0,0 +1,211 @@
+package oidcagent
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// ErrSessionNotFound is returned by a SessionStore when no data is stored
+// for the given session ID.
+var ErrSessionNotFound = errors.New("oidcagent: session not found")
+
+// SessionData is the payload persisted for a logged-in session. It used to
+// live directly in the gin session cookie; it now lives behind a
+// SessionStore, and the browser only ever sees the opaque session ID.
+//
+// ConnectorID and the normalized claims are what let UserInfo, Claims,
+// Refresh, Logout and CodeFlowProxy behave uniformly across connectors.
+// Token and IDToken are only populated for connectors backed by a real
+// upstream oauth2 token - today, just "oidc" - and are empty otherwise.
+type SessionData struct {
+	ConnectorID       string   `json:"connector_id"`
+	Subject           string   `json:"subject"`
+	Email             string   `json:"email,omitempty"`
+	PreferredUsername string   `json:"preferred_username,omitempty"`
+	Groups            []string `json:"groups,omitempty"`
+
+	Token   string `json:"token,omitempty"`
+	IDToken string `json:"id_token,omitempty"`
+}
+
+// SessionStore persists SessionData keyed by an opaque session ID.
+// Implementations are responsible for encrypting anything sensitive
+// before it reaches disk or a shared cache - see KeySet.
+type SessionStore interface {
+	Get(ctx context.Context, sessionID string) (*SessionData, error)
+	Save(ctx context.Context, sessionID string, data *SessionData) error
+	Delete(ctx context.Context, sessionID string) error
+}
+
+const aesKeySize = 32 // AES-256
+
+// KeySet encrypts with its first (primary) key and can decrypt data
+// written under any key in the set. To rotate a key: prepend the new
+// primary, keep the old one around as decrypt-only until every session
+// has cycled through it, then drop it.
+type KeySet struct {
+	keys [][]byte
+}
+
+// NewKeySet builds a KeySet. primary is used for both encryption and
+// decryption; decryptOnly keys are only used to read data written under a
+// previous primary.
+func NewKeySet(primary []byte, decryptOnly ...[]byte) (*KeySet, error) {
+	keys := append([][]byte{primary}, decryptOnly...)
+	for _, k := range keys {
+		if len(k) != aesKeySize {
+			return nil, fmt.Errorf("session keys must be %d bytes for AES-256-GCM, got %d", aesKeySize, len(k))
+		}
+	}
+	return &KeySet{keys: keys}, nil
+}
+
+func (ks *KeySet) encrypt(plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(ks.keys[0])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (ks *KeySet) decrypt(ciphertext []byte) ([]byte, error) {
+	var lastErr error
+	for _, key := range ks.keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(ciphertext) < gcm.NonceSize() {
+			lastErr = fmt.Errorf("ciphertext shorter than nonce size")
+			continue
+		}
+		nonce, ct := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+		plaintext, err := gcm.Open(nil, nonce, ct, nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return plaintext, nil
+	}
+	return nil, fmt.Errorf("unable to decrypt session data with any configured key: %w", lastErr)
+}
+
+// FilesystemStore is a SessionStore backed by one AES-GCM encrypted file
+// per session, in the spirit of gorilla/sessions' FilesystemStore.
+type FilesystemStore struct {
+	dir  string
+	keys *KeySet
+	mu   sync.Mutex
+}
+
+// NewFilesystemStore creates the store directory (mode 0700) if needed and
+// returns a FilesystemStore rooted there.
+func NewFilesystemStore(dir string, keys *KeySet) (*FilesystemStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create session store dir: %w", err)
+	}
+	return &FilesystemStore{dir: dir, keys: keys}, nil
+}
+
+// sessionIDPattern matches the hex format generateNewSID produces. Session
+// IDs reach these methods straight from the unsigned "sid" browser cookie,
+// so anything that isn't this shape is rejected rather than concatenated
+// into a file path - otherwise a crafted cookie value (e.g. containing
+// "../") could read or write outside dir.
+var sessionIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+func (s *FilesystemStore) path(sessionID string) (string, error) {
+	if !sessionIDPattern.MatchString(sessionID) {
+		return "", fmt.Errorf("invalid session id")
+	}
+	return filepath.Join(s.dir, sessionID+".sess"), nil
+}
+
+func (s *FilesystemStore) Get(_ context.Context, sessionID string) (*SessionData, error) {
+	path, err := s.path(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ciphertext, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := s.keys.decrypt(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	var data SessionData
+	if err := json.Unmarshal(plaintext, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+func (s *FilesystemStore) Save(_ context.Context, sessionID string, data *SessionData) error {
+	path, err := s.path(sessionID)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := s.keys.encrypt(plaintext)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return os.WriteFile(path, ciphertext, 0o600)
+}
+
+func (s *FilesystemStore) Delete(_ context.Context, sessionID string) error {
+	path, err := s.path(sessionID)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package oidcagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore is a SessionStore backed by Redis, for deployments running
+// more than one oidcagent replica where a FilesystemStore wouldn't be
+// shared across instances.
+type RedisStore struct {
+	client *redis.Client
+	keys   *KeySet
+	ttl    time.Duration
+}
+
+// NewRedisStore returns a RedisStore. ttl bounds how long a session
+// survives in Redis and should comfortably outlive the refresh token's
+// own lifetime.
+func NewRedisStore(client *redis.Client, keys *KeySet, ttl time.Duration) *RedisStore {
+	return &RedisStore{client: client, keys: keys, ttl: ttl}
+}
+
+func (s *RedisStore) key(sessionID string) string {
+	return "oidcagent:session:" + sessionID
+}
+
+func (s *RedisStore) Get(ctx context.Context, sessionID string) (*SessionData, error) {
+	ciphertext, err := s.client.Get(ctx, s.key(sessionID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := s.keys.decrypt(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	var data SessionData
+	if err := json.Unmarshal(plaintext, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+func (s *RedisStore) Save(ctx context.Context, sessionID string, data *SessionData) error {
+	plaintext, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := s.keys.encrypt(plaintext)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.key(sessionID), ciphertext, s.ttl).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, sessionID string) error {
+	return s.client.Del(ctx, s.key(sessionID)).Err()
+}
@@ -0,0 +1,172 @@
+package oidcagent
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	key := make([]byte, aesKeySize)
+	for i := range key {
+		key[i] = b
+	}
+	return key
+}
+
+func TestKeySetEncryptDecryptRoundTrip(t *testing.T) {
+	ks, err := NewKeySet(testKey(1))
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+
+	plaintext := []byte(`{"subject":"alice"}`)
+	ciphertext, err := ks.encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if string(ciphertext) == string(plaintext) {
+		t.Fatal("ciphertext should not equal plaintext")
+	}
+
+	got, err := ks.decrypt(ciphertext)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if string(got) != string(plaintext) {
+		t.Errorf("decrypt = %q, want %q", got, plaintext)
+	}
+}
+
+func TestKeySetDecryptsWithRotatedOutPrimaryKey(t *testing.T) {
+	oldKS, err := NewKeySet(testKey(1))
+	if err != nil {
+		t.Fatalf("NewKeySet(old): %v", err)
+	}
+	ciphertext, err := oldKS.encrypt([]byte("data encrypted under the old primary"))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	// Simulate rotation: the old primary becomes a decrypt-only key behind
+	// a new primary.
+	newKS, err := NewKeySet(testKey(2), testKey(1))
+	if err != nil {
+		t.Fatalf("NewKeySet(new): %v", err)
+	}
+
+	got, err := newKS.decrypt(ciphertext)
+	if err != nil {
+		t.Fatalf("decrypt with rotated key set: %v", err)
+	}
+	if string(got) != "data encrypted under the old primary" {
+		t.Errorf("decrypt = %q", got)
+	}
+}
+
+func TestKeySetDecryptFailsWithUnknownKey(t *testing.T) {
+	ks1, _ := NewKeySet(testKey(1))
+	ks2, _ := NewKeySet(testKey(2))
+
+	ciphertext, err := ks1.encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if _, err := ks2.decrypt(ciphertext); err == nil {
+		t.Fatal("expected decrypt to fail with a key set that never saw the encryption key")
+	}
+}
+
+func TestNewKeySetRejectsWrongSizedKey(t *testing.T) {
+	if _, err := NewKeySet([]byte("too-short")); err == nil {
+		t.Fatal("expected an error for a non-32-byte key")
+	}
+}
+
+func TestFilesystemStoreSaveGetDelete(t *testing.T) {
+	ks, err := NewKeySet(testKey(1))
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	store, err := NewFilesystemStore(t.TempDir(), ks)
+	if err != nil {
+		t.Fatalf("NewFilesystemStore: %v", err)
+	}
+
+	sid := "0123456789abcdef0123456789abcdef"
+	data := &SessionData{ConnectorID: "oidc", Subject: "alice"}
+
+	if err := store.Save(context.Background(), sid, data); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	got, err := store.Get(context.Background(), sid)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Subject != data.Subject || got.ConnectorID != data.ConnectorID {
+		t.Errorf("Get = %+v, want %+v", got, data)
+	}
+
+	if err := store.Delete(context.Background(), sid); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(context.Background(), sid); err != ErrSessionNotFound {
+		t.Errorf("Get after Delete = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestFilesystemStoreDeleteMissingSessionIsNotAnError(t *testing.T) {
+	ks, _ := NewKeySet(testKey(1))
+	store, err := NewFilesystemStore(t.TempDir(), ks)
+	if err != nil {
+		t.Fatalf("NewFilesystemStore: %v", err)
+	}
+	if err := store.Delete(context.Background(), "0123456789abcdef0123456789abcdef"); err != nil {
+		t.Errorf("Delete of a missing session = %v, want nil", err)
+	}
+}
+
+func TestFilesystemStoreRejectsPathTraversalSessionID(t *testing.T) {
+	ks, _ := NewKeySet(testKey(1))
+	dir := t.TempDir()
+	store, err := NewFilesystemStore(dir, ks)
+	if err != nil {
+		t.Fatalf("NewFilesystemStore: %v", err)
+	}
+
+	malicious := []string{
+		"../../../../etc/passwd",
+		"..%2f..%2fescape",
+		"foo/bar",
+		`foo\bar`,
+		"",
+		"not-hex-but-right-length-0000000",
+	}
+
+	for _, sid := range malicious {
+		if _, err := store.Get(context.Background(), sid); err == nil {
+			t.Errorf("Get(%q): expected an error, got none", sid)
+		}
+		if err := store.Save(context.Background(), sid, &SessionData{}); err == nil {
+			t.Errorf("Save(%q): expected an error, got none", sid)
+		}
+		if err := store.Delete(context.Background(), sid); err == nil {
+			t.Errorf("Delete(%q): expected an error, got none", sid)
+		}
+	}
+}
+
+func TestFilesystemStorePathStaysInsideDir(t *testing.T) {
+	dir := t.TempDir()
+	store := &FilesystemStore{dir: dir}
+
+	sid := "0123456789abcdef0123456789abcdef"
+	path, err := store.path(sid)
+	if err != nil {
+		t.Fatalf("path: %v", err)
+	}
+	if filepath.Dir(path) != dir {
+		t.Errorf("path = %q, want a file directly inside %q", path, dir)
+	}
+}